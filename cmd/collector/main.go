@@ -1,6 +1,10 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
+
 	"wscollector/config"
 	"wscollector/internal/bybit/collector"
 	"wscollector/logger"
@@ -12,6 +16,11 @@ func main() {
 	// viper config
 	cfg := config.Load()
 
+	// schema migrations: wscollector migrate <up|down|status|to>
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+
 	// zap logger
 	log, err := logger.New(cfg.Log)
 	if err != nil {
@@ -20,9 +29,14 @@ func main() {
 	defer log.Sync()
 
 	// run collector
-	if err := collector.StartCollector(cfg, log); err != nil {
+	shutdown, err := collector.StartCollector(cfg, log)
+	if err != nil {
 		log.Fatal("collector failed", zap.Error(err))
 	}
 
-	select {}
+	// wait for a termination signal, then save state before exiting
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Info("shutting down", zap.Stringer("signal", <-sig))
+	shutdown()
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/storage/postgres"
+)
+
+const migrateUsage = `usage: wscollector migrate <command>
+
+commands:
+  up            apply all pending migrations
+  down [N]      revert the last N applied migrations (default 1)
+  status        list migrations and whether they are applied
+  to VERSION    apply or revert migrations until VERSION is the latest applied (0 reverts all)
+  partition     convert kline_record to the partitioned layout of postgres.partition`
+
+// runMigrate runs the migrate subcommand and returns the process exit code.
+func runMigrate(cfg config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err := migrate(cfg, args[0], args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		if errors.Is(err, errMigrateUsage) {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+var errMigrateUsage = errors.New("invalid arguments")
+
+func migrate(cfg config.Config, command string, args []string) error {
+	// Validate arguments before touching the database
+	var n int
+	switch command {
+	case "up", "status", "partition":
+		if len(args) != 0 {
+			return errMigrateUsage
+		}
+	case "down":
+		n = 1
+		if len(args) > 1 {
+			return errMigrateUsage
+		}
+		if len(args) == 1 {
+			steps, err := strconv.Atoi(args[0])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("%w: down needs a positive count, got %q", errMigrateUsage, args[0])
+			}
+			n = steps
+		}
+	case "to":
+		if len(args) != 1 {
+			return errMigrateUsage
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 {
+			return fmt.Errorf("%w: to needs a version, got %q", errMigrateUsage, args[0])
+		}
+		n = version
+	default:
+		return fmt.Errorf("%w: unknown command %q", errMigrateUsage, command)
+	}
+
+	if command != "status" {
+		if err := postgres.CreateDatabase(cfg.Postgres); err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+	}
+	client, err := postgres.NewClient(cfg.Postgres.DSN(cfg.App.Env))
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Migrations can take long on large tables; stop cleanly on Ctrl-C instead of a timeout
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var ran int
+	switch command {
+	case "status":
+		return printMigrationStatus(ctx, client)
+	case "up":
+		ran, err = client.MigrateUp(ctx)
+	case "down":
+		ran, err = client.MigrateDown(ctx, n)
+	case "to":
+		ran, err = client.MigrateTo(ctx, n)
+	case "partition":
+		return partitionKlines(ctx, cfg.Postgres, client)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Hypertable setup is not a versioned migration: it depends on the extension being present
+	if command == "up" && cfg.Postgres.Timescale.Enabled {
+		if err := client.SetupTimescale(ctx, cfg.Postgres.Timescale); errors.Is(err, postgres.ErrTimescaleUnavailable) {
+			fmt.Fprintln(os.Stderr, "migrate: timescaledb unavailable; keeping plain tables:", err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	version, err := client.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("ran %d migration(s); schema version is %d\n", ran, version)
+	return nil
+}
+
+func printMigrationStatus(ctx context.Context, client *postgres.PostgresClient) error {
+	states, err := client.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range states {
+		applied := "pending"
+		if s.Applied {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return w.Flush()
+}
+
+func partitionKlines(ctx context.Context, cfg config.PostgresConfig, client *postgres.PostgresClient) error {
+	if cfg.Timescale.Enabled {
+		return errors.New("postgres.timescale and postgres.partition cannot both be enabled")
+	}
+	if err := postgres.ValidatePartitionConfig(cfg.Partition); err != nil {
+		return err
+	}
+
+	converted, err := client.PartitionKlineTable(ctx, cfg.Partition, func(copied int64) {
+		fmt.Printf("\rcopied %d rows", copied)
+	})
+	if err != nil {
+		return err
+	}
+	if !converted {
+		fmt.Println("kline_record is already partitioned")
+	} else {
+		fmt.Println("\nkline_record is partitioned; the old table is kept as kline_record_legacy")
+	}
+	return client.EnsureKlinePartitions(ctx, cfg.Partition, time.Now())
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +16,7 @@ type Config struct {
 	Bybit    BybitConfig    `mapstructure:"bybit"`
 	Log      LogConfig      `mapstructure:"log"`
 	Postgres PostgresConfig `mapstructure:"postgres"`
+	Memory   MemoryConfig   `mapstructure:"memory"`
 }
 
 type AppConfig struct {
@@ -24,8 +26,16 @@ type AppConfig struct {
 }
 
 type BybitConfig struct {
-	REST RESTConfig `mapstructure:"rest"`
-	WS   WSConfig   `mapstructure:"ws"`
+	REST         RESTConfig         `mapstructure:"rest"`
+	WS           WSConfig           `mapstructure:"ws"`
+	Kline        KlineConfig        `mapstructure:"kline"`
+	AccountRatio AccountRatioConfig `mapstructure:"account_ratio"`
+	Universe     UniverseConfig     `mapstructure:"universe"`
+	Resample     ResampleConfig     `mapstructure:"resample"`
+	Live         LiveConfig         `mapstructure:"live"`
+	Indicators   IndicatorConfig    `mapstructure:"indicators"`
+	Movers       MoversConfig       `mapstructure:"movers"`
+	Correlation  CorrelationConfig  `mapstructure:"correlation"`
 }
 
 type RESTConfig struct {
@@ -33,9 +43,190 @@ type RESTConfig struct {
 	Timeout time.Duration `mapstructure:"timeout"`
 }
 type WSConfig struct {
-	URL      string        `mapstructure:"url"`
-	Timeout  time.Duration `mapstructure:"timeout"`
-	Interval string        `mapstructure:"interval"`
+	URL            string                `mapstructure:"url"`
+	Timeout        time.Duration         `mapstructure:"timeout"`
+	Interval       string                `mapstructure:"interval"`        // single interval (legacy); used when Intervals is empty
+	Intervals      []string              `mapstructure:"intervals"`       // intervals collected for every symbol (e.g., ["1", "5", "60"])
+	IntervalGroups []IntervalGroupConfig `mapstructure:"interval_groups"` // per-symbol-group overrides; first match wins
+}
+
+// IntervalGroupConfig assigns a set of intervals to a group of symbols.
+type IntervalGroupConfig struct {
+	Symbols   []string `mapstructure:"symbols"`
+	Intervals []string `mapstructure:"intervals"`
+}
+
+// IntervalsFor returns the kline intervals collected for the given symbol.
+func (c WSConfig) IntervalsFor(symbol string) []string {
+	for _, group := range c.IntervalGroups {
+		for _, sym := range group.Symbols {
+			if strings.EqualFold(sym, symbol) {
+				return group.Intervals
+			}
+		}
+	}
+	return c.defaultIntervals()
+}
+
+// defaultIntervals returns the intervals for symbols outside every interval group.
+func (c WSConfig) defaultIntervals() []string {
+	if len(c.Intervals) > 0 {
+		return c.Intervals
+	}
+	return []string{c.Interval}
+}
+
+// AllIntervals returns every distinct interval configured across all symbols.
+func (c WSConfig) AllIntervals() []string {
+	seen := make(map[string]struct{})
+	var out []string
+
+	add := func(intervals []string) {
+		for _, interval := range intervals {
+			if _, ok := seen[interval]; !ok {
+				seen[interval] = struct{}{}
+				out = append(out, interval)
+			}
+		}
+	}
+	for _, group := range c.IntervalGroups {
+		add(group.Intervals)
+	}
+	add(c.defaultIntervals())
+	return out
+}
+
+// KlineConfig selects which kline price types are collected per symbol.
+type KlineConfig struct {
+	PriceTypes       []string            `mapstructure:"price_types"`        // default price types for every symbol: "last", "mark", "index", "premium_index"
+	SymbolPriceTypes map[string][]string `mapstructure:"symbol_price_types"` // per-symbol overrides (e.g., BTCUSDT: ["last", "mark"])
+	PollInterval     time.Duration       `mapstructure:"poll_interval"`      // REST polling period for price types without a WS stream
+}
+
+// PriceTypesFor returns the price types configured for the given symbol.
+// Symbol overrides take precedence; "last" is used when nothing is configured.
+func (c KlineConfig) PriceTypesFor(symbol string) []string {
+	// viper lowercases map keys, so compare symbols case-insensitively
+	for sym, types := range c.SymbolPriceTypes {
+		if strings.EqualFold(sym, symbol) {
+			return types
+		}
+	}
+	if len(c.PriceTypes) > 0 {
+		return c.PriceTypes
+	}
+	return []string{"last"}
+}
+
+// AccountRatioConfig controls long/short account ratio collection.
+type AccountRatioConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Period   string        `mapstructure:"period"`   // "5min", "15min", "30min", "1h", "4h", "1d"
+	Backfill time.Duration `mapstructure:"backfill"` // history to fetch for symbols with no stored samples
+}
+
+// UniverseConfig filters the instruments list down to the symbols that are collected.
+// Allow always includes and Deny always excludes a symbol; every other symbol must pass all filters.
+type UniverseConfig struct {
+	QuoteCoins      []string `mapstructure:"quote_coins"`      // e.g., ["USDT"]; empty accepts any
+	ContractTypes   []string `mapstructure:"contract_types"`   // e.g., ["LinearPerpetual"]; empty accepts any
+	TradingOnly     bool     `mapstructure:"trading_only"`     // require status == "Trading"
+	Allow           []string `mapstructure:"allow"`            // symbols always included
+	Deny            []string `mapstructure:"deny"`             // symbols always excluded
+	IncludePatterns []string `mapstructure:"include_patterns"` // regexes; if set, a symbol must match one
+	ExcludePatterns []string `mapstructure:"exclude_patterns"` // regexes; a matching symbol is excluded
+	MinTurnover24h  float64  `mapstructure:"min_turnover_24h"` // minimum 24h turnover from tickers; 0 disables
+	DedupeBaseCoin  bool     `mapstructure:"dedupe_base_coin"` // keep one symbol per base coin, preferring perpetuals
+	MaxSymbols      int      `mapstructure:"max_symbols"`      // keep the highest-turnover symbols; 0 means unlimited
+}
+
+// ResampleConfig controls local building of higher-timeframe candles from confirmed 1m candles.
+// Only symbols subscribed to the "1" interval are resampled.
+type ResampleConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Intervals []string `mapstructure:"intervals"` // DB interval values, e.g. ["2m", "5m", "10m", "1h"]
+}
+
+// LiveConfig controls tracking of forming (unconfirmed) candles.
+type LiveConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`          // keep the latest forming candle per symbol/interval in memory
+	Persist         bool          `mapstructure:"persist"`          // upsert forming candles to Postgres
+	PersistInterval time.Duration `mapstructure:"persist_interval"` // minimum time between upserts per symbol/interval
+}
+
+// IndicatorConfig selects the technical indicators maintained per symbol and interval.
+// Groups override the default indicator set for matching symbols; first match wins.
+type IndicatorConfig struct {
+	Enabled    bool                   `mapstructure:"enabled"`
+	Persist    bool                   `mapstructure:"persist"`    // write the latest values to Postgres on every update
+	Intervals  []string               `mapstructure:"intervals"`  // DB intervals the default set applies to; empty means all
+	Indicators []IndicatorSpec        `mapstructure:"indicators"` // default indicator set
+	Groups     []IndicatorGroupConfig `mapstructure:"groups"`
+}
+
+// IndicatorSpec describes one indicator, e.g. {type: ema, period: 20}.
+type IndicatorSpec struct {
+	Type   string  `mapstructure:"type"`   // ema, rsi, atr, vwap, bollinger, volatility
+	Period int     `mapstructure:"period"` // lookback in candles; unused by vwap
+	StdDev float64 `mapstructure:"stddev"` // bollinger band width in standard deviations (default 2)
+}
+
+// IndicatorGroupConfig assigns an indicator set to a group of symbols and intervals.
+type IndicatorGroupConfig struct {
+	Symbols    []string        `mapstructure:"symbols"`
+	Intervals  []string        `mapstructure:"intervals"` // empty means all intervals
+	Indicators []IndicatorSpec `mapstructure:"indicators"`
+}
+
+// SpecsFor returns the indicators maintained for a symbol at a DB interval (e.g., "1m").
+func (c IndicatorConfig) SpecsFor(symbol, interval string) []IndicatorSpec {
+	matches := func(v string) bool { return strings.EqualFold(v, symbol) }
+	for _, group := range c.Groups {
+		if slices.ContainsFunc(group.Symbols, matches) && (len(group.Intervals) == 0 || slices.Contains(group.Intervals, interval)) {
+			return group.Indicators
+		}
+	}
+	if len(c.Intervals) == 0 || slices.Contains(c.Intervals, interval) {
+		return c.Indicators
+	}
+	return nil
+}
+
+// AllSpecs returns the default indicator set followed by every group's indicators.
+func (c IndicatorConfig) AllSpecs() []IndicatorSpec {
+	specs := append([]IndicatorSpec(nil), c.Indicators...)
+	for _, group := range c.Groups {
+		specs = append(specs, group.Indicators...)
+	}
+	return specs
+}
+
+// MoversConfig controls the cross-sectional performance ranking refreshed on every minute close.
+type MoversConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval string        `mapstructure:"interval"` // DB interval of the candles ranked (default "1m")
+	Window   time.Duration `mapstructure:"window"`   // trailing window (default 4h)
+	RankBy   string        `mapstructure:"rank_by"`  // return, range or turnover (default return)
+	Settle   time.Duration `mapstructure:"settle"`   // delay after a minute closes before ranking (default 2s)
+}
+
+// CorrelationConfig controls rolling correlation and beta of every symbol against a benchmark.
+type CorrelationConfig struct {
+	Enabled         bool          `mapstructure:"enabled"`
+	Benchmark       string        `mapstructure:"benchmark"`        // benchmark symbol (default BTCUSDT)
+	Interval        string        `mapstructure:"interval"`         // DB interval of the returns (default "1m")
+	Windows         []int         `mapstructure:"windows"`          // window lengths in returns (default [60, 240, 1440])
+	PersistInterval time.Duration `mapstructure:"persist_interval"` // how often snapshots are written to Postgres; 0 disables
+}
+
+// MemoryConfig bounds and seeds the in-memory kline store. Zero values disable a setting.
+type MemoryConfig struct {
+	KlineMaxCount int           `mapstructure:"kline_max_count"` // klines kept per symbol
+	KlineMaxAge   time.Duration `mapstructure:"kline_max_age"`   // klines older than this relative to the newest are evicted
+	WarmStart     time.Duration `mapstructure:"warm_start"`      // history loaded from Postgres at startup; 0 disables
+
+	StatePath     string        `mapstructure:"state_path"`     // local file the stores are saved to and restored from; empty disables
+	StateInterval time.Duration `mapstructure:"state_interval"` // how often the state file is rewritten; it is always written on shutdown
 }
 
 // Options defines the logger configuration options.
@@ -67,6 +258,13 @@ func Load() Config {
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 
+	// Configs written before versioned migrations kept migrating at startup
+	v.SetDefault("postgres.auto_migrate", true)
+	// Configs without a universe section keep collecting one USDT symbol per base coin
+	v.SetDefault("bybit.universe.quote_coins", []string{"USDT"})
+	v.SetDefault("bybit.universe.trading_only", true)
+	v.SetDefault("bybit.universe.dedupe_base_coin", true)
+
 	if err := v.ReadInConfig(); err != nil {
 		log.Fatalf("failed to read config: %v", err)
 	}
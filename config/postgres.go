@@ -11,6 +11,18 @@ import (
 
 // PostgresConfig defines the configuration for connecting to a PostgreSQL database.
 type PostgresConfig struct {
+	// Disabled runs the collector without a database: klines are kept in memory only
+	// and features that need Postgres (warm start, account ratio, persistence) are skipped.
+	Disabled bool `mapstructure:"disabled"`
+	// AutoMigrate applies pending schema migrations at startup (default true). When false,
+	// startup fails on a schema that is behind and migrations are run with the migrate
+	// command instead.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+	// ConflictPolicy resolves a confirmed kline that arrives again with different values:
+	// keep (default) the stored row, overwrite it, or keep it and record the new values
+	// as a revision.
+	ConflictPolicy string `mapstructure:"conflict_policy"`
+
 	Host     string `mapstructure:"host"`
 	Port     int    `mapstructure:"port"`
 	User     string `mapstructure:"user"`
@@ -22,6 +34,69 @@ type PostgresConfig struct {
 	MaxOpenConns    int           `mapstructure:"max_open_conns"`
 	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+
+	Writer    PostgresWriterConfig `mapstructure:"writer"`
+	Timescale TimescaleConfig      `mapstructure:"timescale"`
+	Partition PartitionConfig      `mapstructure:"partition"`
+	Retention RetentionConfig      `mapstructure:"retention"`
+}
+
+// RetentionConfig removes old klines on a schedule. Each kline is governed by the first rule
+// matching its interval and symbol; klines without a matching rule are kept forever.
+type RetentionConfig struct {
+	Enabled    bool            `mapstructure:"enabled"`
+	Every      time.Duration   `mapstructure:"every"`       // time between runs (default 1h)
+	ChunkSize  int             `mapstructure:"chunk_size"`  // rows per DELETE (default 5000)
+	ChunkPause time.Duration   `mapstructure:"chunk_pause"` // pause between DELETEs to spare the database
+	DryRun     bool            `mapstructure:"dry_run"`     // only log what would be removed
+	Rules      []RetentionRule `mapstructure:"rules"`
+}
+
+// RetentionRule keeps klines of one interval, optionally only for symbols matching a glob
+// pattern such as "*USDC", for Keep. A zero Keep keeps them forever.
+type RetentionRule struct {
+	Interval string        `mapstructure:"interval"`
+	Symbols  string        `mapstructure:"symbols"`
+	Keep     time.Duration `mapstructure:"keep"`
+}
+
+// PartitionConfig partitions kline_record by interval and then by ranges of start, so old
+// candles are removed by dropping partitions instead of deleting rows. It excludes Timescale.
+type PartitionConfig struct {
+	Enabled   bool     `mapstructure:"enabled"`
+	Period    string   `mapstructure:"period"`     // day, week or month (default month)
+	Premake   int      `mapstructure:"premake"`    // upcoming periods created ahead (default 2)
+	Intervals []string `mapstructure:"intervals"`  // intervals with their own partitions; others share "default"
+	CopyBatch int      `mapstructure:"copy_batch"` // rows per batch when converting an existing table (default 10000)
+}
+
+// TimescaleConfig turns kline_record into a TimescaleDB hypertable when the extension is
+// available. Without the extension the collector keeps using plain tables.
+type TimescaleConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	ChunkInterval time.Duration `mapstructure:"chunk_interval"` // time range per chunk (default 24h)
+	CompressAfter time.Duration `mapstructure:"compress_after"` // compress chunks older than this; 0 disables compression
+	Aggregates    []string      `mapstructure:"aggregates"`     // DB intervals built from 1m as continuous aggregates, e.g. 5m, 1h, 1d
+}
+
+// PostgresWriterConfig tunes the batching kline writer. Zero values use the writer's defaults.
+type PostgresWriterConfig struct {
+	BatchSize     int           `mapstructure:"batch_size"`     // rows per INSERT
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // longest time a row waits before being written
+	QueueSize     int           `mapstructure:"queue_size"`     // rows buffered before writers block
+	Timeout       time.Duration `mapstructure:"timeout"`        // statement timeout per batch
+
+	Spill PostgresSpillConfig `mapstructure:"spill"`
+}
+
+// PostgresSpillConfig keeps klines on local disk while Postgres is unreachable and writes
+// them back once it recovers. Zero values use the spill's defaults.
+type PostgresSpillConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Dir          string        `mapstructure:"dir"`           // directory of the segment files
+	SegmentBytes int64         `mapstructure:"segment_bytes"` // size of one segment file
+	MaxBytes     int64         `mapstructure:"max_bytes"`     // total size before new rows are rejected
+	ReplayEvery  time.Duration `mapstructure:"replay_every"`  // how often Postgres is checked while rows are spilled
 }
 
 func (cfg *PostgresConfig) DSN(env string) string {
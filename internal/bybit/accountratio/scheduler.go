@@ -0,0 +1,122 @@
+package accountratio
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// Collector periodically fetches the long/short account ratio for every tracked symbol
+// and stores it in Postgres.
+type Collector struct {
+	RestClient  *bybit.RESTClient
+	SymbolStore *memorystore.MemorySymbolStore
+	Postgres    *postgres.PostgresClient
+	Logger      *zap.Logger
+
+	Period   bybit.AccountRatioPeriod
+	Backfill time.Duration
+	Timeout  time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Start runs one collection pass immediately, which backfills any missing history,
+// and then repeats shortly after every period boundary until Stop is called.
+func (c *Collector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		period := c.Period.Duration()
+
+		c.runOnce(ctx)
+
+		for {
+			// Wait until just after the next period boundary so the sample is published
+			now := time.Now().UTC()
+			next := now.Truncate(period).Add(period).Add(10 * time.Second)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			c.runOnce(ctx)
+		}
+	}()
+}
+
+// Stop ends collection, cancelling the requests of a pass in progress, and waits for it to return.
+func (c *Collector) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+}
+
+// runOnce fetches every symbol's samples since the newest stored one (or the backfill window).
+func (c *Collector) runOnce(ctx context.Context) {
+	end := time.Now()
+	inserted := int64(0)
+
+	for _, symbol := range c.SymbolStore.GetAll() {
+		if ctx.Err() != nil {
+			return // stopping
+		}
+		n, err := c.collectSymbol(ctx, symbol, end)
+		if err != nil {
+			c.Logger.Warn("failed to collect account ratio", zap.String("symbol", symbol), zap.Error(err))
+			continue
+		}
+		inserted += n
+	}
+
+	c.Logger.Info("account ratio collected",
+		zap.String("period", string(c.Period)),
+		zap.Int64("inserted", inserted),
+	)
+}
+
+func (c *Collector) collectSymbol(ctx context.Context, symbol string, end time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	start := end.Add(-c.Backfill)
+	latest, err := c.Postgres.GetLatestAccountRatioTime(ctx, symbol, string(c.Period))
+	if err != nil {
+		return 0, err
+	}
+	if latest.After(start) {
+		start = latest
+	}
+
+	samples, err := c.RestClient.GetAccountRatio(ctx, "linear", symbol, c.Period, start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	records := make([]*postgres.AccountRatioRecord, 0, len(samples))
+	for _, sample := range samples {
+		record, err := postgres.ToAccountRatioRecord(string(c.Period), sample)
+		if err != nil {
+			c.Logger.Warn("failed to convert account ratio", zap.String("symbol", symbol), zap.Error(err))
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return c.Postgres.InsertAccountRatios(ctx, records)
+}
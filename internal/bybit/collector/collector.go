@@ -2,29 +2,129 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"wscollector/config"
+	"wscollector/internal/bybit/accountratio"
+	"wscollector/internal/bybit/correlation"
+	"wscollector/internal/bybit/indicator"
 	"wscollector/internal/bybit/memorystore"
+	"wscollector/internal/bybit/movers"
+	"wscollector/internal/bybit/resample"
 	"wscollector/internal/bybit/snapshot"
 	"wscollector/internal/bybit/stream"
 	"wscollector/internal/bybit/symbolmeta"
 	"wscollector/pkg/bybit"
 	"wscollector/pkg/storage/postgres"
+	"wscollector/pkg/storage/sink"
 
 	"go.uber.org/zap"
 )
 
 // StartCollector initializes the data pipeline for Bybit linear market data.
 // It loads symbol metadata via REST, sets up a WebSocket stream for klines,
-// and stores them in-memory (and optionally to DB).
-func StartCollector(cfg config.Config, logger *zap.Logger) error {
+// and stores them through a fan-out sink: in memory, and in Postgres unless it is disabled.
+// The returned shutdown function stops background consumers, saves the in-memory state
+// and closes the kline store.
+func StartCollector(cfg config.Config, logger *zap.Logger) (func(), error) {
 
-	// Initialize PostgreSQL Client
-	postgresClient, err := postgres.InitializeAndMigrateKlineRecord(cfg.App.Env, cfg.Postgres, true)
-	if err != nil {
-		return fmt.Errorf("failed to connect to DB: %w", err)
+	// Initialize PostgreSQL Client; features that need it are skipped when it is disabled
+	var postgresClient *postgres.PostgresClient
+	var writer *postgres.KlineWriter
+	var spill *postgres.KlineSpill
+	if !cfg.Postgres.Disabled {
+		var err error
+		postgresClient, err = postgres.InitializeAndMigrate(cfg.App.Env, cfg.Postgres, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to DB: %w", err)
+		}
+		if cfg.Postgres.Timescale.Enabled && cfg.Postgres.Partition.Enabled {
+			return nil, errors.New("postgres.timescale and postgres.partition cannot both be enabled")
+		}
+		if cfg.Postgres.Partition.Enabled {
+			if err := postgres.ValidatePartitionConfig(cfg.Postgres.Partition); err != nil {
+				return nil, fmt.Errorf("invalid partition config: %w", err)
+			}
+		}
+		if cfg.Postgres.Retention.Enabled {
+			if err := postgres.ValidateRetentionConfig(cfg.Postgres.Retention); err != nil {
+				return nil, fmt.Errorf("invalid retention config: %w", err)
+			}
+		}
+		if cfg.Postgres.Timescale.Enabled {
+			if err := setupTimescale(cfg.Postgres, postgresClient); errors.Is(err, postgres.ErrTimescaleUnavailable) {
+				logger.Warn("timescaledb unavailable; using plain tables", zap.Error(err))
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to set up timescaledb: %w", err)
+			} else {
+				logger.Info("timescaledb enabled", zap.Strings("aggregates", postgresClient.AggregateIntervals()))
+			}
+		}
+
+		// Klines Postgres cannot take are kept on disk, including those left by the last run
+		if spillCfg := cfg.Postgres.Writer.Spill; spillCfg.Enabled {
+			spill, err = postgres.OpenKlineSpill(postgres.KlineSpillConfig{
+				Dir:          spillCfg.Dir,
+				SegmentBytes: spillCfg.SegmentBytes,
+				MaxBytes:     spillCfg.MaxBytes,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to open kline spill: %w", err)
+			}
+			if stats := spill.Stats(); stats.Bytes > 0 {
+				logger.Info("kline spill has rows from a previous run",
+					zap.Int("segments", stats.Segments), zap.Int64("bytes", stats.Bytes))
+			}
+		}
+
+		// Write confirmed klines to Postgres in batches
+		writer = postgresClient.NewKlineWriter(postgres.KlineWriterConfig{
+			BatchSize:     cfg.Postgres.Writer.BatchSize,
+			FlushInterval: cfg.Postgres.Writer.FlushInterval,
+			QueueSize:     cfg.Postgres.Writer.QueueSize,
+			Timeout:       cfg.Postgres.Writer.Timeout,
+			Spill:         spill,
+			ReplayEvery:   cfg.Postgres.Writer.Spill.ReplayEvery,
+			OnBatch: func(result postgres.BatchResult) {
+				if result.Spilled > 0 {
+					logger.Debug("spilled kline batch", zap.Int("rows", result.Spilled), zap.Error(result.Err))
+					return
+				}
+				if result.Err != nil {
+					logger.Warn("failed to write kline batch", zap.Int("rows", result.Rows), zap.Error(result.Err))
+					return
+				}
+				if result.Conflicts > 0 {
+					logger.Warn("confirmed klines changed on re-delivery",
+						zap.Int("conflicts", result.Conflicts),
+						zap.String("policy", cfg.Postgres.ConflictPolicy),
+					)
+				}
+				logger.Debug("wrote kline batch",
+					zap.Int("rows", result.Rows),
+					zap.Int("inserted", result.Inserted),
+					zap.Int("duplicates", result.Duplicates),
+					zap.Int("conflicts", result.Conflicts),
+					zap.Duration("took", result.Took),
+				)
+			},
+			OnReplay: func(result postgres.ReplayResult) {
+				if result.Quarantined > 0 {
+					logger.Warn("postgres rejected spilled klines; moved them to quarantine",
+						zap.Int("rows", result.Quarantined), zap.String("dir", cfg.Postgres.Writer.Spill.Dir))
+				}
+				if result.Err != nil {
+					logger.Warn("kline spill replay stopped", zap.Int("rows", result.Rows), zap.Error(result.Err))
+					return
+				}
+				logger.Info("replayed spilled klines", zap.Int("rows", result.Rows), zap.Duration("took", result.Took))
+			},
+		})
+	} else {
+		logger.Warn("postgres disabled; klines are kept in memory only")
 	}
 
 	// Create REST client and channel for symbol metadata
@@ -42,19 +142,76 @@ func StartCollector(cfg config.Config, logger *zap.Logger) error {
 		Load: symbolmeta.DefaultLoadFn(loader),
 	}
 
-	// Parse the interval string into a KlineIntervalMeta type
-	klineMeta, err := bybit.ParseKlineInterval(cfg.Bybit.WS.Interval)
-	if err != nil {
-		return fmt.Errorf("failed to parse interval: %w", err)
+	// Validate every configured interval before subscribing
+	for _, interval := range cfg.Bybit.WS.AllIntervals() {
+		if _, err := bybit.ParseKlineInterval(interval); err != nil {
+			return nil, fmt.Errorf("failed to parse interval: %w", err)
+		}
 	}
 
 	// Initialize in-memory symbol store and start worker to consume incoming symbols
-	symbolStore := memorystore.NewSymbolStore(klineMeta.APIValue, logger)
+	symbolStore := memorystore.NewSymbolStore(cfg.Bybit.WS.IntervalsFor, logger)
+
+	// Initialize in-memory kline store, dropping symbols that leave the symbol set
+	klineStore := memorystore.NewKlineStore(memorystore.KlineRetention{
+		MaxCount: cfg.Memory.KlineMaxCount,
+		MaxAge:   cfg.Memory.KlineMaxAge,
+	})
+	symbolStore.OnSymbolsChanged(klineStore.RetainSymbols)
+
+	// Confirmed klines go to every storage backend through one sink
+	sinks := []sink.KlineSink{sink.Memory(klineStore)}
+	if writer != nil {
+		sinks = append(sinks, sink.Postgres(writer))
+	}
+	klineSink := sink.NewFanOut(sinks...)
+
+	// Restore the state saved by the previous run before the first symbol sync
+	saveState := func() {}
+	if cfg.Memory.StatePath != "" {
+		restoreState(logger, cfg.Memory.StatePath, klineStore, symbolStore)
+		saveState = startStateSaver(logger, cfg.Memory.StatePath, cfg.Memory.StateInterval, klineStore, symbolStore)
+	}
+	// Shutdown steps run in reverse order of registration
+	closers := []func(){func() { klineSink.Close() }, klineStore.Close, saveState}
+	if spill != nil {
+		// After the writer's last batch, which may still spill
+		closers = append([]func(){func() { spill.Close() }}, closers...)
+	}
+	if postgresClient != nil && cfg.Postgres.Partition.Enabled {
+		closers = append(closers, startPartitionMaintenance(logger, cfg.Postgres, postgresClient))
+	}
+	if postgresClient != nil && cfg.Postgres.Retention.Enabled {
+		closers = append(closers, startRetention(logger, cfg.Postgres, postgresClient))
+	}
+	shutdown := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+
 	midnight.Start(symbolStore.StartSymbolSyncWorker)
 
 	logger.Info("waiting 5 seconds before starting symbol sync", zap.String("reason", "initialization delay"))
 	time.Sleep(5 * time.Second)
 
+	// Warm-start klines from Postgres before any stream data
+	if cfg.Memory.WarmStart > 0 && postgresClient != nil {
+		var derived []string
+		if cfg.Bybit.Resample.Enabled {
+			derived = cfg.Bybit.Resample.Intervals
+		}
+		warmStart(logger, postgresClient, klineStore, symbolStore, derived, cfg.Memory.WarmStart)
+	}
+
+	// REST backfill and polling write to klineSink, so shutdown stops them before the sinks close
+	restCtx, cancelREST := context.WithCancel(context.Background())
+	var restTasks sync.WaitGroup
+	closers = append(closers, func() {
+		cancelREST()
+		restTasks.Wait()
+	})
+
 	// TODO: Concurrent tasks
 	sem := make(chan struct{}, 10) // max 10 concurrent tasks
 	// Prepare kline subscription topics
@@ -66,45 +223,23 @@ func StartCollector(cfg config.Config, logger *zap.Logger) error {
 		symbol := symbol // capture
 		sem <- struct{}{}
 
+		restTasks.Add(1)
 		go func() {
+			defer restTasks.Done()
 			defer func() { <-sem }()
 
 			var failed bool
-
-			// Context with timeout for safety
-			ctx, cancel := context.WithTimeout(context.Background(), cfg.Bybit.REST.Timeout)
-			// fetch
-			restData, err := restClient.GetKlines(ctx, "linear", symbol,
-				cfg.Bybit.WS.Interval, start, end)
-			cancel()
-			if err != nil {
-				logger.Warn("failed to fetch kline from REST", zap.String("symbol", symbol), zap.Error(err))
-				failed = true
-				goto LOG_DONE
-			}
-
-			for _, kline := range restData {
-				// Convert to DB record
-				klineRecord, err := postgres.ToKlineRecord(symbol, kline)
-				if err != nil {
-					logger.Warn("failed to convert kline data to kline record", zap.String("symbol", symbol), zap.Error(err))
-					failed = true
-					continue
-				}
-
-				// Insert Kline record into Postgres
-				// context for DB insert (short timeout)
-				dbCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-				err = postgresClient.InsertKline(dbCtx, klineRecord)
-				cancel()
-				if err != nil {
-					logger.Warn("failed to insert kline into DB", zap.String("symbol", symbol), zap.Error(err))
-					failed = true
-					continue
+			for _, interval := range symbolStore.IntervalsFor(symbol) {
+				for _, priceType := range cfg.Bybit.Kline.PriceTypesFor(symbol) {
+					if restCtx.Err() != nil {
+						return // shutting down
+					}
+					if !backfillKlines(restCtx, cfg, logger, restClient, klineSink, symbol, interval, priceType, start, end) {
+						failed = true
+					}
 				}
 			}
 
-		LOG_DONE:
 			if failed {
 				logger.Warn("finished with errors for symbol", zap.String("symbol", symbol))
 			} else {
@@ -113,18 +248,172 @@ func StartCollector(cfg config.Config, logger *zap.Logger) error {
 		}()
 	}
 
+	// Collect long/short account ratio for all tracked symbols
+	if cfg.Bybit.AccountRatio.Enabled && postgresClient == nil {
+		logger.Warn("account ratio collection needs postgres; skipping")
+	} else if cfg.Bybit.AccountRatio.Enabled {
+		period, err := bybit.ParseAccountRatioPeriod(cfg.Bybit.AccountRatio.Period)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse account ratio period: %w", err)
+		}
+
+		ratioCollector := &accountratio.Collector{
+			RestClient:  restClient,
+			SymbolStore: symbolStore,
+			Postgres:    postgresClient,
+			Logger:      logger,
+			Period:      period,
+			Backfill:    cfg.Bybit.AccountRatio.Backfill,
+			Timeout:     cfg.Bybit.REST.Timeout,
+		}
+		ratioCollector.Start()
+		closers = append(closers, ratioCollector.Stop)
+	}
+
+	// Maintain technical indicators from confirmed candles in the memory store
+	if cfg.Bybit.Indicators.Enabled {
+		for _, spec := range cfg.Bybit.Indicators.AllSpecs() {
+			if _, err := indicator.New(spec); err != nil {
+				return nil, fmt.Errorf("failed to parse indicator: %w", err)
+			}
+		}
+
+		var indicatorDB *postgres.PostgresClient
+		if cfg.Bybit.Indicators.Persist && postgresClient != nil {
+			indicatorDB = postgresClient
+		}
+
+		engine := indicator.NewEngine(klineStore, cfg.Bybit.Indicators.SpecsFor, indicatorDB, logger)
+		engine.Start()
+		closers = append(closers, engine.Stop)
+	}
+
+	// Rank symbols by trailing performance after every minute close
+	if cfg.Bybit.Movers.Enabled {
+		moversService, err := movers.NewService(cfg.Bybit.Movers, klineStore, symbolStore, postgresClient, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create movers service: %w", err)
+		}
+		moversService.Start()
+		closers = append(closers, moversService.Stop)
+	}
+
+	// Track rolling correlation and beta against the benchmark symbol
+	if cfg.Bybit.Correlation.Enabled {
+		var correlationDB *postgres.PostgresClient
+		if cfg.Bybit.Correlation.PersistInterval > 0 && postgresClient != nil {
+			correlationDB = postgresClient
+		}
+
+		tracker, err := correlation.NewTracker(cfg.Bybit.Correlation, klineStore, correlationDB, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create correlation tracker: %w", err)
+		}
+		tracker.Start()
+		closers = append(closers, tracker.Stop)
+	}
+
+	// Poll price types that have no WebSocket stream (mark, index, premium index);
+	// only Postgres stores them, so there is nothing to poll for without it
+	if writer != nil {
+		restTasks.Add(1)
+		go func() {
+			defer restTasks.Done()
+			pollPriceKlines(restCtx, cfg, logger, restClient, klineSink, symbolStore)
+		}()
+	}
+
 	// Initialize WebSocket client
 	wsClient := bybit.NewWSClient(cfg.Bybit.WS.URL, symbolStore, logger)
-	klineStore := memorystore.NewKlineStore()
+
+	// Build higher timeframes locally from 1m candles
+	var resampler *resample.Resampler
+	if cfg.Bybit.Resample.Enabled {
+		var err error
+		resampler, err = resample.NewResampler(cfg.Bybit.Resample.Intervals, func(symbol string) []string {
+			return nativeDBIntervals(symbolStore.IntervalsFor(symbol))
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create resampler: %w", err)
+		}
+	}
+
+	// Track forming candles
+	var live *stream.LiveTracker
+	if cfg.Bybit.Live.Enabled {
+		live = &stream.LiveTracker{
+			Store:           memorystore.NewLiveStore(),
+			PersistInterval: cfg.Bybit.Live.PersistInterval,
+		}
+		if cfg.Bybit.Live.Persist && postgresClient != nil {
+			live.Postgres = postgresClient
+		}
+		live.Start(logger)
+		closers = append(closers, live.Stop)
+	}
 
 	// Register WebSocket message handler
-	wsClient.SetMessageHandler(stream.MakeMessageHandler(logger, klineStore, postgresClient))
+	wsClient.SetMessageHandler(stream.MakeMessageHandler(logger, klineSink, resampler, live))
 
 	// Periodically print stored Kline count for visibility
 	go func() {
 		for {
-			count := klineStore.CountAll()
-			logger.Info("current saved klines", zap.Int("count", count))
+			stats := klineStore.Stats()
+			logger.Info("current saved klines",
+				zap.Int("count", stats.Klines),
+				zap.Int("symbols", stats.Symbols),
+				zap.Int64("approx_bytes", stats.ApproxBytes),
+				zap.Int64("evicted_by_count", stats.EvictedByCount),
+				zap.Int64("evicted_by_age", stats.EvictedByAge),
+				zap.Int64("evicted_symbols", stats.EvictedSymbols),
+			)
+
+			if writer != nil {
+				stats := writer.Stats()
+				logger.Info("kline writer stats",
+					zap.Int64("batches", stats.Batches),
+					zap.Int64("rows", stats.Rows),
+					zap.Int64("inserted", stats.Inserted),
+					zap.Int64("duplicates", stats.Duplicates),
+					zap.Int64("conflicts", stats.Conflicts),
+					zap.Int64("spilled", stats.Spilled),
+					zap.Int64("failed", stats.Failed),
+				)
+			}
+
+			if spill != nil {
+				stats := spill.Stats()
+				logger.Info("kline spill stats",
+					zap.Int("segments", stats.Segments),
+					zap.Int64("bytes", stats.Bytes),
+					zap.Int64("spilled", stats.Spilled),
+					zap.Int64("replayed", stats.Replayed),
+					zap.Int64("rejected", stats.Rejected),
+					zap.Int64("quarantined", stats.Quarantined),
+					zap.Int64("corrupt", stats.Corrupt),
+				)
+			}
+
+			for _, health := range klineSink.Status() {
+				if !health.Healthy {
+					logger.Warn("kline sink unhealthy",
+						zap.String("sink", health.Name),
+						zap.Int64("errors", health.Errors),
+						zap.Time("last_success", health.LastSuccessAt),
+						zap.Error(health.LastError),
+					)
+				}
+			}
+
+			if resampler != nil {
+				stats := resampler.Stats()
+				logger.Info("resampler stats",
+					zap.Int64("emitted", stats.Emitted),
+					zap.Int64("verified", stats.Verified),
+					zap.Int64("mismatched", stats.Mismatched),
+					zap.Int64("incomplete", stats.Incomplete),
+				)
+			}
 
 			time.Sleep(5 * time.Second)
 		}
@@ -132,9 +421,121 @@ func StartCollector(cfg config.Config, logger *zap.Logger) error {
 
 	// Connect to WebSocket with the list of symbols
 	if err := wsClient.Connect(); err != nil {
-		return err
+		return nil, err
 	}
 	go wsClient.Listen() // explicitly start listener
+	// Registered last so it runs first: no message reaches the sinks once they start closing
+	closers = append(closers, wsClient.Close)
+
+	return shutdown, nil
+}
+
+// backfillKlines fetches klines of one interval and price type for a symbol over [start, end]
+// and writes them to klineSink, so the memory store has no gap between the warm start and
+// the live stream and Postgres has the history.
+// It returns false if any step failed.
+func backfillKlines(ctx context.Context, cfg config.Config, logger *zap.Logger, restClient *bybit.RESTClient,
+	klineSink sink.KlineSink, symbol, interval, priceType string, start, end time.Time) bool {
+	parsedType, err := bybit.ParseKlinePriceType(priceType)
+	if err != nil {
+		logger.Warn("skipping unknown kline price type", zap.String("symbol", symbol), zap.Error(err))
+		return false
+	}
+
+	// Context with timeout for safety
+	ctx, cancel := context.WithTimeout(ctx, cfg.Bybit.REST.Timeout)
+	// fetch
+	restData, err := restClient.GetPriceKlines(ctx, "linear", symbol,
+		interval, parsedType, start, end)
+	cancel()
+	if err != nil {
+		logger.Warn("failed to fetch kline from REST", zap.String("symbol", symbol),
+			zap.String("interval", interval), zap.String("price_type", priceType), zap.Error(err))
+		return false
+	}
+
+	ok := true
+	now := time.Now().UnixMilli()
+	for _, kline := range restData {
+		if kline.End >= now {
+			continue // candle is still forming
+		}
+
+		// The memory sink keeps last-traded klines only; other price types go to Postgres
+		err := klineSink.WriteKline(memorystore.KlineMemory{Symbol: symbol, Kline: kline})
+		if err != nil {
+			logger.Warn("failed to write backfilled kline", zap.String("symbol", symbol),
+				zap.String("interval", interval), zap.String("price_type", priceType), zap.Error(err))
+			ok = false
+		}
+	}
+	return ok
+}
+
+// pollPriceKlines periodically fetches the recent window of every configured price type
+// that Bybit does not stream over WebSocket and writes it to klineSink, until ctx is done.
+func pollPriceKlines(ctx context.Context, cfg config.Config, logger *zap.Logger, restClient *bybit.RESTClient,
+	klineSink sink.KlineSink, symbolStore *memorystore.MemorySymbolStore) {
+	period := cfg.Bybit.Kline.PollInterval
+	if period <= 0 {
+		period = time.Minute
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		end := time.Now()
 
-	return nil
+		for _, symbol := range symbolStore.GetAll() {
+			if ctx.Err() != nil {
+				return
+			}
+			for _, priceType := range cfg.Bybit.Kline.PriceTypesFor(symbol) {
+				if bybit.KlinePriceType(priceType).HasStream() {
+					continue // delivered by the WebSocket stream
+				}
+				for _, interval := range symbolStore.IntervalsFor(symbol) {
+					// Look back two candles (or two polls) so the last closed candle is always covered
+					meta, err := bybit.ParseKlineInterval(interval)
+					if err != nil {
+						continue
+					}
+					start := meta.Add(end, -2)
+					if polled := end.Add(-2 * period); polled.Before(start) {
+						start = polled
+					}
+					backfillKlines(ctx, cfg, logger, restClient, klineSink, symbol, interval, priceType, start, end)
+				}
+			}
+		}
+	}
+}
+
+// nativeDBIntervals converts subscribed API intervals (e.g., "60") into DB values (e.g., "1h").
+func nativeDBIntervals(intervals []string) []string {
+	out := make([]string, 0, len(intervals))
+	for _, interval := range intervals {
+		if meta, err := bybit.ParseKlineInterval(interval); err == nil {
+			out = append(out, meta.DBValue)
+		}
+	}
+	return out
+}
+
+// setupTimescale converts kline_record to a hypertable when auto-migration is on. Otherwise the
+// migrate command owns schema changes and only the existing aggregates are used for reads.
+func setupTimescale(cfg config.PostgresConfig, postgresClient *postgres.PostgresClient) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	if cfg.AutoMigrate {
+		return postgresClient.SetupTimescale(ctx, cfg.Timescale)
+	}
+	return postgresClient.LoadTimescaleAggregates(ctx, cfg.Timescale)
 }
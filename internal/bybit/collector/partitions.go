@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// partitionMaintenanceInterval is how often upcoming partitions are created.
+const partitionMaintenanceInterval = time.Hour
+
+// startPartitionMaintenance keeps kline_record partitioned: with auto-migration it first converts
+// a plain table online, then it creates upcoming partitions every hour. Expired partitions are
+// dropped by the retention scheduler.
+// It returns a function that stops the maintenance and waits for the current step.
+func startPartitionMaintenance(logger *zap.Logger, cfg config.PostgresConfig,
+	postgresClient *postgres.PostgresClient) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if cfg.AutoMigrate {
+			convertKlineTable(ctx, logger, cfg.Partition, postgresClient)
+		}
+
+		ticker := time.NewTicker(partitionMaintenanceInterval)
+		defer ticker.Stop()
+		for {
+			maintainPartitions(ctx, logger, cfg.Partition, postgresClient)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+// convertKlineTable partitions a plain kline_record while the collector keeps writing to it.
+func convertKlineTable(ctx context.Context, logger *zap.Logger, cfg config.PartitionConfig,
+	postgresClient *postgres.PostgresClient) {
+	began := time.Now()
+	lastLog := began
+	converted, err := postgresClient.PartitionKlineTable(ctx, cfg, func(copied int64) {
+		if time.Since(lastLog) >= 10*time.Second {
+			lastLog = time.Now()
+			logger.Info("partitioning kline table", zap.Int64("copied", copied))
+		}
+	})
+	if err != nil {
+		logger.Error("failed to partition kline table; retrying at next start", zap.Error(err))
+		return
+	}
+	if converted {
+		logger.Info("partitioned kline table; the old table is kept as kline_record_legacy",
+			zap.Duration("took", time.Since(began)))
+	}
+}
+
+// maintainPartitions creates upcoming partitions once kline_record is partitioned.
+func maintainPartitions(ctx context.Context, logger *zap.Logger, cfg config.PartitionConfig,
+	postgresClient *postgres.PostgresClient) {
+	partitioned, err := postgresClient.KlinePartitioned(ctx)
+	if err != nil {
+		logger.Warn("failed to check kline partitioning", zap.Error(err))
+		return
+	}
+	if !partitioned {
+		return
+	}
+
+	if err := postgresClient.EnsureKlinePartitions(ctx, cfg, time.Now()); err != nil {
+		logger.Error("failed to create kline partitions", zap.Error(err))
+	}
+}
@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// startRetention applies the retention rules now and then every cfg.Retention.Every, and
+// returns a function that stops the scheduler and waits for a running pass to stop.
+func startRetention(logger *zap.Logger, cfg config.PostgresConfig, postgresClient *postgres.PostgresClient) func() {
+	every := cfg.Retention.Every
+	if every <= 0 {
+		every = time.Hour
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		for {
+			applyRetention(ctx, logger, cfg, postgresClient)
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+// applyRetention runs one retention pass and logs what every rule removed.
+func applyRetention(ctx context.Context, logger *zap.Logger, cfg config.PostgresConfig,
+	postgresClient *postgres.PostgresClient) {
+	began := time.Now()
+	runs, err := postgresClient.ApplyRetention(ctx, cfg.Retention, cfg.Partition, began)
+
+	var rows int64
+	var partitions int
+	for _, run := range runs {
+		names := make([]string, len(run.Partitions))
+		for i, part := range run.Partitions {
+			names[i] = part.Name
+		}
+		rows += run.Rows
+		partitions += len(run.Partitions)
+		logger.Info("applied kline retention rule",
+			zap.String("interval", run.Rule.Interval),
+			zap.String("symbols", run.Rule.Symbols),
+			zap.Time("cutoff", run.Cutoff),
+			zap.Int64("rows", run.Rows),
+			zap.Strings("partitions", names),
+			zap.Duration("took", run.Took),
+			zap.Bool("dry_run", cfg.Retention.DryRun),
+		)
+	}
+	if err != nil && ctx.Err() == nil {
+		logger.Error("kline retention failed", zap.Error(err))
+	}
+	logger.Info("kline retention finished",
+		zap.Int64("rows", rows),
+		zap.Int("partitions", partitions),
+		zap.Duration("took", time.Since(began)),
+		zap.Bool("dry_run", cfg.Retention.DryRun),
+	)
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+
+	"go.uber.org/zap"
+)
+
+// restoreState loads the local state file into the stores, if one exists.
+// A missing, corrupt or incompatible file is logged and ignored.
+func restoreState(logger *zap.Logger, path string,
+	klineStore *memorystore.MemoryKlineStore, symbolStore *memorystore.MemorySymbolStore) {
+	began := time.Now()
+
+	snap, err := memorystore.ReadStateFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Info("no state file to restore", zap.String("path", path))
+		return
+	}
+	if err != nil {
+		logger.Warn("ignoring unreadable state file", zap.String("path", path), zap.Error(err))
+		return
+	}
+
+	restored := snap.Restore(klineStore, symbolStore)
+	logger.Info("restored in-memory state",
+		zap.String("path", path),
+		zap.Time("created_at", time.UnixMilli(snap.CreatedAt)),
+		zap.Int("symbols", len(snap.Symbols)),
+		zap.Int("klines", restored),
+		zap.Duration("took", time.Since(began)),
+	)
+}
+
+// startStateSaver rewrites the state file every interval (if positive) and returns a
+// function that stops the saver and writes the state one final time.
+func startStateSaver(logger *zap.Logger, path string, interval time.Duration,
+	klineStore *memorystore.MemoryKlineStore, symbolStore *memorystore.MemorySymbolStore) func() {
+	save := func() {
+		began := time.Now()
+		snap := memorystore.CaptureState(klineStore, symbolStore)
+		if err := memorystore.WriteStateFile(path, snap); err != nil {
+			logger.Error("failed to save in-memory state", zap.String("path", path), zap.Error(err))
+			return
+		}
+		logger.Info("saved in-memory state",
+			zap.String("path", path),
+			zap.Int("symbols", len(snap.Symbols)),
+			zap.Int("klines", len(snap.Klines)),
+			zap.Duration("took", time.Since(began)),
+		)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	if interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					save()
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			save()
+		})
+	}
+}
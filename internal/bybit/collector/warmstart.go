@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// warmStartChunk is how many symbols are read from Postgres per query.
+const warmStartChunk = 50
+
+// warmStart loads the last window of confirmed klines per symbol and interval from
+// Postgres into the memory store. The store deduplicates by start, so candles that
+// later arrive again from the backfill or the WebSocket stream overlap cleanly.
+// derived lists resampled DB intervals, loaded for every symbol that streams 1m candles.
+func warmStart(logger *zap.Logger, postgresClient *postgres.PostgresClient,
+	klineStore *memorystore.MemoryKlineStore, symbolStore *memorystore.MemorySymbolStore,
+	derived []string, window time.Duration) {
+	end := time.Now()
+	start := end.Add(-window)
+
+	// Group symbols by DB interval so each query covers many symbols
+	byInterval := make(map[string][]string)
+	for _, symbol := range symbolStore.GetAll() {
+		for _, interval := range symbolStore.IntervalsFor(symbol) {
+			meta, err := bybit.ParseKlineInterval(interval)
+			if err != nil {
+				continue
+			}
+			byInterval[meta.DBValue] = append(byInterval[meta.DBValue], symbol)
+
+			if meta.DBValue == "1m" {
+				for _, d := range derived {
+					byInterval[d] = append(byInterval[d], symbol)
+				}
+			}
+		}
+	}
+
+	loaded := 0
+	for interval, symbols := range byInterval {
+		for i := 0; i < len(symbols); i += warmStartChunk {
+			chunk := symbols[i:min(i+warmStartChunk, len(symbols))]
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			records, err := postgresClient.GetKlineRange(ctx, chunk, interval, start, end)
+			cancel()
+			if err != nil {
+				logger.Warn("failed to warm-start klines", zap.String("interval", interval),
+					zap.Int("symbols", len(chunk)), zap.Error(err))
+				continue
+			}
+
+			for _, record := range records {
+				klineStore.Add(memorystore.KlineMemory{
+					Symbol: record.Symbol,
+					Kline:  postgres.FromKlineRecord(record),
+				})
+			}
+			loaded += len(records)
+		}
+	}
+
+	logger.Info("warm-started kline store from Postgres",
+		zap.Duration("window", window),
+		zap.Int("klines", loaded),
+		zap.Duration("took", time.Since(end)),
+	)
+}
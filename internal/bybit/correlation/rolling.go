@@ -0,0 +1,77 @@
+package correlation
+
+import "math"
+
+// rollingPair keeps running sums over the last size (x, y) observations, where x is a
+// symbol's return and y the benchmark's return for the same candle. The sums are
+// recomputed exactly every size additions so floating-point error stays bounded.
+type rollingPair struct {
+	size       int
+	xs, ys     []float64 // ring buffers
+	head, n    int
+	sx, sy     float64
+	sxx, syy   float64
+	sxy        float64
+	sinceExact int
+}
+
+func newRollingPair(size int) *rollingPair {
+	return &rollingPair{size: size, xs: make([]float64, size), ys: make([]float64, size)}
+}
+
+func (r *rollingPair) add(x, y float64) {
+	if r.n == r.size {
+		ox, oy := r.xs[r.head], r.ys[r.head]
+		r.sx -= ox
+		r.sy -= oy
+		r.sxx -= ox * ox
+		r.syy -= oy * oy
+		r.sxy -= ox * oy
+	} else {
+		r.n++
+	}
+
+	r.xs[r.head], r.ys[r.head] = x, y
+	r.head = (r.head + 1) % r.size
+	r.sx += x
+	r.sy += y
+	r.sxx += x * x
+	r.syy += y * y
+	r.sxy += x * y
+
+	r.sinceExact++
+	if r.sinceExact >= r.size {
+		r.recompute()
+	}
+}
+
+func (r *rollingPair) recompute() {
+	r.sx, r.sy, r.sxx, r.syy, r.sxy = 0, 0, 0, 0, 0
+	for i := 0; i < r.n; i++ {
+		x, y := r.xs[i], r.ys[i]
+		r.sx += x
+		r.sy += y
+		r.sxx += x * x
+		r.syy += y * y
+		r.sxy += x * y
+	}
+	r.sinceExact = 0
+}
+
+// stats returns the correlation of x with y and the beta of x on y.
+// It returns false with fewer than two observations or when either side has no variance.
+func (r *rollingPair) stats() (corr, beta float64, ok bool) {
+	if r.n < 2 {
+		return 0, 0, false
+	}
+	n := float64(r.n)
+	mx, my := r.sx/n, r.sy/n
+	cov := r.sxy/n - mx*my
+	varX := r.sxx/n - mx*mx
+	varY := r.syy/n - my*my
+	if varX <= 0 || varY <= 0 {
+		return 0, 0, false
+	}
+	corr = math.Max(-1, math.Min(1, cov/math.Sqrt(varX*varY)))
+	return corr, cov / varY, true
+}
@@ -0,0 +1,406 @@
+package correlation
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// Stat is a symbol's rolling correlation and beta against the benchmark over one window.
+type Stat struct {
+	Symbol      string
+	Benchmark   string
+	Window      int   // window length in returns
+	Samples     int   // returns in the window so far; equals Window once full
+	AsOf        int64 // start of the newest candle in the window, in milliseconds
+	Correlation float64
+	Beta        float64
+}
+
+// Tracker maintains rolling correlation and beta of every symbol's log returns against
+// a benchmark's, updated as confirmed candles land in a MemoryKlineStore. A symbol's
+// return for a candle is paired with the benchmark's return for the same candle,
+// whichever arrives first.
+type Tracker struct {
+	store     *memorystore.MemoryKlineStore
+	postgres  *postgres.PostgresClient // nil disables persistence
+	logger    *zap.Logger
+	benchmark string
+	meta      bybit.KlineIntervalMeta
+	windows   []int
+	maxWindow int
+	persist   time.Duration
+
+	mu        sync.RWMutex
+	symbols   map[string]*symbolState
+	benchRets map[int64]float64 // the benchmark's returns by candle start, last maxWindow
+	benchLast int64
+
+	sub  *memorystore.KlineSubscription
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+type timedReturn struct {
+	start int64
+	value float64
+}
+
+type symbolState struct {
+	prevStart  int64
+	prevClose  float64
+	returns    []timedReturn     // newest last, at most 2*maxWindow
+	pending    map[int64]float64 // returns waiting for the benchmark's return
+	lastPaired int64
+	windows    []*rollingPair
+}
+
+// NewTracker creates a tracker from its config. Unset fields default to BTCUSDT 1m returns
+// over windows of 60, 240 and 1440 returns.
+func NewTracker(cfg config.CorrelationConfig, store *memorystore.MemoryKlineStore,
+	postgresClient *postgres.PostgresClient, logger *zap.Logger) (*Tracker, error) {
+	t := &Tracker{
+		store:     store,
+		postgres:  postgresClient,
+		logger:    logger,
+		benchmark: cfg.Benchmark,
+		windows:   append([]int(nil), cfg.Windows...),
+		persist:   cfg.PersistInterval,
+		symbols:   make(map[string]*symbolState),
+		benchRets: make(map[int64]float64),
+	}
+
+	if t.benchmark == "" {
+		t.benchmark = "BTCUSDT"
+	}
+	interval := cfg.Interval
+	if interval == "" {
+		interval = "1m"
+	}
+	var err error
+	if t.meta, err = bybit.ParseDBInterval(interval); err != nil {
+		return nil, err
+	}
+	if len(t.windows) == 0 {
+		t.windows = []int{60, 240, 1440}
+	}
+	sort.Ints(t.windows)
+	for _, w := range t.windows {
+		if w < 2 {
+			return nil, fmt.Errorf("correlation window must be at least 2 returns, got %d", w)
+		}
+	}
+	t.maxWindow = t.windows[len(t.windows)-1]
+	return t, nil
+}
+
+// Start subscribes to the store, primes the benchmark from stored history, and
+// persists snapshots every PersistInterval when Postgres is configured.
+func (t *Tracker) Start() {
+	t.sub = t.store.Subscribe(memorystore.KlineFilter{Intervals: []string{t.meta.DBValue}}, memorystore.SubscribeOptions{
+		Buffer: 4096,
+		Policy: memorystore.DropNewest, // gaps are recovered from the store on the next candle
+	})
+	t.stop = make(chan struct{})
+
+	if latest := t.store.Latest(t.benchmark, t.meta.DBValue, 1); len(latest) == 1 {
+		t.Apply(memorystore.KlineMemory{Symbol: t.benchmark, Kline: latest[0]})
+	}
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		for k := range t.sub.C {
+			t.Apply(k)
+		}
+	}()
+
+	if t.postgres != nil && t.persist > 0 {
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			ticker := time.NewTicker(t.persist)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+					t.saveSnapshot()
+				case <-t.stop:
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Stop ends the update and persistence loops.
+func (t *Tracker) Stop() {
+	if t.sub == nil {
+		return
+	}
+	t.sub.Unsubscribe()
+	close(t.stop)
+	t.wg.Wait()
+}
+
+// Apply feeds a confirmed candle of the tracked interval. Stored candles between the
+// symbol's previous candle and k are applied first, so history and dropped candles
+// are not missed.
+func (t *Tracker) Apply(k memorystore.KlineMemory) {
+	if k.Interval != t.meta.DBValue || !k.Confirm {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := t.state(k.Symbol)
+	if k.Start <= s.prevStart {
+		return
+	}
+	for _, missed := range t.store.Range(k.Symbol, k.Interval, s.prevStart+1, k.Start) {
+		t.applyUnlocked(k.Symbol, s, missed)
+	}
+	t.applyUnlocked(k.Symbol, s, k.Kline)
+}
+
+// Get returns a symbol's stats for every window with at least two paired returns.
+func (t *Tracker) Get(symbol string) []Stat {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s, ok := t.symbols[symbol]
+	if !ok || symbol == t.benchmark {
+		return nil
+	}
+	return t.statsUnlocked(symbol, s)
+}
+
+// GetAll returns the stats of every symbol, ordered by symbol and window.
+func (t *Tracker) GetAll() []Stat {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.symbols))
+	for symbol := range t.symbols {
+		if symbol != t.benchmark {
+			names = append(names, symbol)
+		}
+	}
+	sort.Strings(names)
+
+	var out []Stat
+	for _, symbol := range names {
+		out = append(out, t.statsUnlocked(symbol, t.symbols[symbol])...)
+	}
+	return out
+}
+
+// Matrix returns the pairwise correlation of the given symbols' last window returns
+// (all tracked symbols, including the benchmark, when symbols is empty). Each pair uses
+// the candles both symbols have; pairs with fewer than two common returns are NaN.
+// The cost is quadratic in the number of symbols, so it is computed on demand only.
+func (t *Tracker) Matrix(window int, symbols []string) ([]string, [][]float64) {
+	window = max(window, 2)
+
+	t.mu.RLock()
+	if len(symbols) == 0 {
+		for symbol := range t.symbols {
+			symbols = append(symbols, symbol)
+		}
+	}
+	symbols = append([]string(nil), symbols...)
+	sort.Strings(symbols)
+
+	// Returns oldest first, so pairs are summed in the same order on every call, and by
+	// candle start for lookup
+	series := make([][]timedReturn, len(symbols))
+	byStart := make([]map[int64]float64, len(symbols))
+	for i, symbol := range symbols {
+		byStart[i] = make(map[int64]float64)
+		if s, ok := t.symbols[symbol]; ok {
+			rets := s.returns
+			if len(rets) > window {
+				rets = rets[len(rets)-window:]
+			}
+			series[i] = append([]timedReturn(nil), rets...)
+			for _, r := range rets {
+				byStart[i][r.start] = r.value
+			}
+		}
+	}
+	t.mu.RUnlock()
+
+	m := make([][]float64, len(symbols))
+	for i := range m {
+		m[i] = make([]float64, len(symbols))
+		m[i][i] = 1
+	}
+	for i := 0; i < len(symbols); i++ {
+		for j := i + 1; j < len(symbols); j++ {
+			r := newRollingPair(window)
+			for _, x := range series[i] {
+				if y, ok := byStart[j][x.start]; ok {
+					r.add(x.value, y)
+				}
+			}
+			corr, _, ok := r.stats()
+			if !ok {
+				corr = math.NaN()
+			}
+			m[i][j], m[j][i] = corr, corr
+		}
+	}
+	return symbols, m
+}
+
+func (t *Tracker) state(symbol string) *symbolState {
+	s, ok := t.symbols[symbol]
+	if !ok {
+		s = &symbolState{pending: make(map[int64]float64)}
+		for _, w := range t.windows {
+			s.windows = append(s.windows, newRollingPair(w))
+		}
+		t.symbols[symbol] = s
+	}
+	return s
+}
+
+// applyUnlocked turns a candle into a log return and pairs it. The caller must hold t.mu.
+func (t *Tracker) applyUnlocked(symbol string, s *symbolState, k memorystore.Kline) {
+	c := k.Close.Float64()
+	consecutive := s.prevStart != 0 && t.meta.Next(time.UnixMilli(s.prevStart)).UnixMilli() == k.Start
+	prevClose := s.prevClose
+	s.prevStart, s.prevClose = k.Start, c
+
+	if !consecutive || prevClose <= 0 || c <= 0 {
+		return // no return across a gap
+	}
+	ret := math.Log(c / prevClose)
+
+	s.returns = append(s.returns, timedReturn{start: k.Start, value: ret})
+	if len(s.returns) >= 2*t.maxWindow {
+		s.returns = append(s.returns[:0], s.returns[len(s.returns)-t.maxWindow:]...)
+	}
+
+	if symbol == t.benchmark {
+		t.applyBenchmarkUnlocked(k.Start, ret)
+		return
+	}
+
+	if y, ok := t.benchRets[k.Start]; ok {
+		s.pair(k.Start, ret, y)
+	} else if k.Start > t.benchLast {
+		s.pending[k.Start] = ret
+		prune(s.pending, t.maxWindow)
+	}
+}
+
+// applyBenchmarkUnlocked records a benchmark return and pairs every symbol's pending
+// return for the same candle. Pending returns for earlier candles the benchmark
+// skipped can never be paired and are dropped.
+func (t *Tracker) applyBenchmarkUnlocked(start int64, ret float64) {
+	t.benchRets[start] = ret
+	t.benchLast = start
+	prune(t.benchRets, t.maxWindow)
+
+	for symbol, s := range t.symbols {
+		if symbol == t.benchmark || len(s.pending) == 0 {
+			continue
+		}
+		if x, ok := s.pending[start]; ok {
+			s.pair(start, x, ret)
+		}
+		for ps := range s.pending {
+			if ps <= start {
+				delete(s.pending, ps)
+			}
+		}
+	}
+}
+
+func (s *symbolState) pair(start int64, x, y float64) {
+	if start <= s.lastPaired {
+		return
+	}
+	s.lastPaired = start
+	for _, w := range s.windows {
+		w.add(x, y)
+	}
+}
+
+func (t *Tracker) statsUnlocked(symbol string, s *symbolState) []Stat {
+	var out []Stat
+	for i, w := range s.windows {
+		corr, beta, ok := w.stats()
+		if !ok {
+			continue
+		}
+		out = append(out, Stat{
+			Symbol:      symbol,
+			Benchmark:   t.benchmark,
+			Window:      t.windows[i],
+			Samples:     w.n,
+			AsOf:        s.lastPaired,
+			Correlation: corr,
+			Beta:        beta,
+		})
+	}
+	return out
+}
+
+// saveSnapshot writes the stats of every full window to Postgres.
+func (t *Tracker) saveSnapshot() {
+	var records []*postgres.CorrelationRecord
+	for _, stat := range t.GetAll() {
+		if stat.Samples < stat.Window {
+			continue
+		}
+		records = append(records, &postgres.CorrelationRecord{
+			Symbol:      stat.Symbol,
+			Benchmark:   stat.Benchmark,
+			Interval:    t.meta.DBValue,
+			Window:      stat.Window,
+			AsOf:        time.UnixMilli(stat.AsOf),
+			Correlation: stat.Correlation,
+			Beta:        stat.Beta,
+			Samples:     stat.Samples,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	inserted, err := t.postgres.InsertCorrelations(ctx, records)
+	if err != nil {
+		t.logger.Warn("failed to persist correlation snapshot", zap.Error(err))
+		return
+	}
+	t.logger.Debug("persisted correlation snapshot", zap.Int("stats", len(records)), zap.Int64("inserted", inserted))
+}
+
+// prune keeps the newest n entries of a map keyed by candle start once it holds 2n,
+// so the sort is amortized over n insertions.
+func prune(m map[int64]float64, n int) {
+	if len(m) < 2*n {
+		return
+	}
+	starts := make([]int64, 0, len(m))
+	for start := range m {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts[:len(starts)-n] {
+		delete(m, start)
+	}
+}
@@ -0,0 +1,86 @@
+package correlation
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
+
+	"go.uber.org/zap"
+)
+
+func add(store *memorystore.MemoryKlineStore, symbol string, i int64, close float64) memorystore.KlineMemory {
+	k := memorystore.KlineMemory{Symbol: symbol, Kline: memorystore.Kline{
+		Start:    i * 60000,
+		Interval: "1m",
+		Close:    decimal.MustParse(strconv.FormatFloat(close, 'f', -1, 64)),
+		Confirm:  true,
+	}}
+	store.Add(k)
+	return k
+}
+
+// go test -v --run TestRollingPair
+func TestRollingPair(t *testing.T) {
+	r := newRollingPair(3)
+	for _, v := range []float64{100, 1, 2, 3} { // the first pair falls out of the window
+		r.add(2*v, v)
+	}
+	corr, beta, ok := r.stats()
+	if !ok || math.Abs(corr-1) > 1e-9 || math.Abs(beta-2) > 1e-9 {
+		t.Errorf("expected corr 1 and beta 2, got %v %v %v", corr, beta, ok)
+	}
+
+	flat := newRollingPair(3)
+	flat.add(1, 1)
+	flat.add(2, 1)
+	if _, _, ok := flat.stats(); ok {
+		t.Error("expected no stats without benchmark variance")
+	}
+}
+
+// go test -v --run TestTrackerPairsReturns
+func TestTrackerPairsReturns(t *testing.T) {
+	store := memorystore.NewKlineStore(memorystore.KlineRetention{})
+	tracker, err := NewTracker(config.CorrelationConfig{Windows: []int{3}}, store, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bench := []float64{100, 101, 99, 102, 100}
+	alt := []float64{10, 10.2, 9.8, 10.4, 10}
+
+	// The symbol's candles arrive before the benchmark's for the same minute
+	for i := range bench {
+		tracker.Apply(add(store, "ALTUSDT", int64(i+1), alt[i]))
+		tracker.Apply(add(store, "BTCUSDT", int64(i+1), bench[i]))
+	}
+
+	stats := tracker.Get("ALTUSDT")
+	if len(stats) != 1 || stats[0].Samples != 3 || stats[0].AsOf != 5*60000 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats[0].Correlation < 0.99 || stats[0].Beta < 1.5 {
+		t.Errorf("expected strong positive co-movement with beta near 2, got %+v", stats[0])
+	}
+	if tracker.Get("BTCUSDT") != nil {
+		t.Error("expected no stats for the benchmark itself")
+	}
+
+	symbols, m := tracker.Matrix(4, nil)
+	if len(symbols) != 2 || math.Abs(m[0][1]-m[1][0]) > 0 || m[0][0] != 1 {
+		t.Errorf("unexpected matrix %v %v", symbols, m)
+	}
+	for range 20 {
+		if _, again := tracker.Matrix(4, nil); again[0][1] != m[0][1] {
+			t.Fatalf("matrix changed between calls: %v then %v", m[0][1], again[0][1])
+		}
+	}
+
+	if _, err := NewTracker(config.CorrelationConfig{Windows: []int{1}}, store, nil, zap.NewNop()); err == nil {
+		t.Error("expected an error for a window shorter than 2")
+	}
+}
@@ -0,0 +1,206 @@
+package indicator
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// subscriberBuffer is the engine's kline subscription buffer. Candles dropped when it
+// overflows are recovered from the store on the next candle of the same series.
+const subscriberBuffer = 4096
+
+// Snapshot holds the indicator values of one symbol and interval after a candle.
+type Snapshot struct {
+	Symbol   string
+	Interval string
+	Start    int64              // start of the last candle applied, in milliseconds
+	Values   map[string]float64 // only indicators that have seen enough candles; read-only
+}
+
+// Engine maintains indicators per symbol and interval from the confirmed candles
+// added to a MemoryKlineStore. A series is primed from the store's history the first
+// time one of its candles arrives, then updated incrementally.
+type Engine struct {
+	store    *memorystore.MemoryKlineStore
+	specsFor func(symbol, interval string) []config.IndicatorSpec
+	postgres *postgres.PostgresClient // nil disables persistence
+	logger   *zap.Logger
+
+	mu     sync.RWMutex
+	series map[memorystore.SeriesKey]*series
+	sub    *memorystore.KlineSubscription
+	done   chan struct{}
+}
+
+type series struct {
+	indicators []Indicator
+	last       int64 // start of the last candle applied
+	snapshot   Snapshot
+}
+
+// NewEngine creates an engine that reads candles from store.
+// specsFor returns the indicators for a symbol at a DB interval; nil skips the series.
+func NewEngine(store *memorystore.MemoryKlineStore, specsFor func(symbol, interval string) []config.IndicatorSpec,
+	postgresClient *postgres.PostgresClient, logger *zap.Logger) *Engine {
+	return &Engine{
+		store:    store,
+		specsFor: specsFor,
+		postgres: postgresClient,
+		logger:   logger,
+		series:   make(map[memorystore.SeriesKey]*series),
+	}
+}
+
+// Start subscribes to the store and applies candles until Stop is called or the store is closed.
+func (e *Engine) Start() {
+	e.sub = e.store.Subscribe(memorystore.KlineFilter{}, memorystore.SubscribeOptions{
+		Buffer: subscriberBuffer,
+		Policy: memorystore.DropNewest,
+	})
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+		for k := range e.sub.C {
+			if snap, ok := e.Apply(k); ok && e.postgres != nil {
+				e.persist(snap)
+			}
+		}
+	}()
+}
+
+// Stop unsubscribes from the store and waits for pending candles to be applied.
+func (e *Engine) Stop() {
+	if e.sub == nil {
+		return
+	}
+	e.sub.Unsubscribe()
+	<-e.done
+}
+
+// Apply updates the indicators of k's series. Candles the series has not seen yet
+// (history on first use, or candles dropped from the subscription) are read from the
+// store first. It returns the resulting snapshot, or false if the series has no
+// indicators or k was already applied.
+func (e *Engine) Apply(k memorystore.KlineMemory) (Snapshot, bool) {
+	key := memorystore.SeriesKey{Symbol: k.Symbol, Interval: k.Interval}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s, ok := e.series[key]
+	if !ok {
+		var err error
+		if s, err = e.newSeries(key); err != nil {
+			e.logger.Warn("invalid indicator config", zap.String("symbol", key.Symbol),
+				zap.String("interval", key.Interval), zap.Error(err))
+		}
+		e.series[key] = s
+	}
+	if len(s.indicators) == 0 || k.Start <= s.last {
+		return Snapshot{}, false
+	}
+
+	// Catch up on every stored candle between the last applied one and k
+	missed := e.store.Range(key.Symbol, key.Interval, s.last+1, k.Start)
+	for _, m := range missed {
+		s.apply(m)
+	}
+	s.apply(k.Kline)
+
+	s.snapshot = Snapshot{Symbol: key.Symbol, Interval: key.Interval, Start: k.Start, Values: s.values()}
+	return s.snapshot, true
+}
+
+// Get returns the latest indicator values of a symbol and interval.
+func (e *Engine) Get(symbol, interval string) (Snapshot, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	s, ok := e.series[memorystore.SeriesKey{Symbol: symbol, Interval: interval}]
+	if !ok || s.snapshot.Values == nil {
+		return Snapshot{}, false
+	}
+	return s.snapshot, true
+}
+
+// GetAll returns the latest indicator values of every series, ordered by symbol and interval.
+func (e *Engine) GetAll() []Snapshot {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	out := make([]Snapshot, 0, len(e.series))
+	for _, s := range e.series {
+		if s.snapshot.Values != nil {
+			out = append(out, s.snapshot)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Symbol != out[j].Symbol {
+			return out[i].Symbol < out[j].Symbol
+		}
+		return out[i].Interval < out[j].Interval
+	})
+	return out
+}
+
+func (e *Engine) newSeries(key memorystore.SeriesKey) (*series, error) {
+	s := &series{}
+	for _, spec := range e.specsFor(key.Symbol, key.Interval) {
+		ind, err := New(spec)
+		if err != nil {
+			return &series{}, err
+		}
+		s.indicators = append(s.indicators, ind)
+	}
+	return s, nil
+}
+
+func (e *Engine) persist(snap Snapshot) {
+	start := time.UnixMilli(snap.Start)
+	records := make([]*postgres.IndicatorRecord, 0, len(snap.Values))
+	for name, value := range snap.Values {
+		records = append(records, &postgres.IndicatorRecord{
+			Symbol:   snap.Symbol,
+			Interval: snap.Interval,
+			Start:    start,
+			Name:     name,
+			Value:    value,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.postgres.UpsertIndicators(ctx, records); err != nil {
+		e.logger.Warn("failed to persist indicators", zap.String("symbol", snap.Symbol),
+			zap.String("interval", snap.Interval), zap.Error(err))
+	}
+}
+
+func (s *series) apply(k memorystore.Kline) {
+	for _, ind := range s.indicators {
+		ind.Update(k)
+	}
+	s.last = k.Start
+}
+
+func (s *series) values() map[string]float64 {
+	out := make(map[string]float64)
+	for _, ind := range s.indicators {
+		for name, v := range ind.Values() {
+			out[name] = v
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
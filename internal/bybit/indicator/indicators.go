@@ -0,0 +1,278 @@
+package indicator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+)
+
+// Indicator is updated with one confirmed candle at a time, oldest first.
+// Values are float64: indicators are analytics and never written back as prices.
+type Indicator interface {
+	// Name identifies the indicator and its parameters, e.g. "ema_20".
+	Name() string
+	// Update applies the next candle of the series.
+	Update(k memorystore.Kline)
+	// Values returns the current outputs keyed by name, or nil until enough candles were seen.
+	Values() map[string]float64
+}
+
+// New creates an indicator from its config spec.
+func New(spec config.IndicatorSpec) (Indicator, error) {
+	typ := strings.ToLower(spec.Type)
+	if typ != "vwap" && spec.Period < 1 {
+		return nil, fmt.Errorf("indicator %q: period must be positive", spec.Type)
+	}
+
+	switch typ {
+	case "ema":
+		return &ema{period: spec.Period}, nil
+	case "rsi":
+		return &rsi{period: spec.Period}, nil
+	case "atr":
+		return &atr{period: spec.Period}, nil
+	case "vwap":
+		return &vwap{}, nil
+	case "bollinger":
+		width := spec.StdDev
+		if width == 0 {
+			width = 2
+		}
+		return &bollinger{period: spec.Period, width: width}, nil
+	case "volatility":
+		if spec.Period < 2 {
+			return nil, fmt.Errorf("indicator %q: period must be at least 2", spec.Type)
+		}
+		return &volatility{period: spec.Period}, nil
+	default:
+		return nil, fmt.Errorf("unsupported indicator type: %q", spec.Type)
+	}
+}
+
+// ema is an exponential moving average of closes, seeded with the simple average of
+// the first period closes.
+type ema struct {
+	period int
+	count  int
+	sum    float64
+	value  float64
+}
+
+func (e *ema) Name() string { return "ema_" + strconv.Itoa(e.period) }
+
+func (e *ema) Update(k memorystore.Kline) {
+	c := k.Close.Float64()
+	e.count++
+	if e.count <= e.period {
+		e.sum += c
+		e.value = e.sum / float64(e.count)
+		return
+	}
+	alpha := 2 / float64(e.period+1)
+	e.value += alpha * (c - e.value)
+}
+
+func (e *ema) Values() map[string]float64 {
+	if e.count < e.period {
+		return nil
+	}
+	return map[string]float64{e.Name(): e.value}
+}
+
+// rsi is Wilder's relative strength index.
+type rsi struct {
+	period    int
+	count     int // price changes seen
+	prevClose float64
+	hasPrev   bool
+	avgGain   float64
+	avgLoss   float64
+}
+
+func (r *rsi) Name() string { return "rsi_" + strconv.Itoa(r.period) }
+
+func (r *rsi) Update(k memorystore.Kline) {
+	c := k.Close.Float64()
+	if !r.hasPrev {
+		r.prevClose, r.hasPrev = c, true
+		return
+	}
+
+	change := c - r.prevClose
+	r.prevClose = c
+	gain, loss := math.Max(change, 0), math.Max(-change, 0)
+
+	r.count++
+	n := float64(r.period)
+	if r.count <= r.period {
+		r.avgGain += gain / n
+		r.avgLoss += loss / n
+		return
+	}
+	r.avgGain = (r.avgGain*(n-1) + gain) / n
+	r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+}
+
+func (r *rsi) Values() map[string]float64 {
+	if r.count < r.period {
+		return nil
+	}
+	value := 100.0
+	if r.avgLoss > 0 {
+		value = 100 - 100/(1+r.avgGain/r.avgLoss)
+	} else if r.avgGain == 0 {
+		value = 50 // flat series
+	}
+	return map[string]float64{r.Name(): value}
+}
+
+// atr is Wilder's average true range.
+type atr struct {
+	period    int
+	count     int
+	prevClose float64
+	value     float64
+}
+
+func (a *atr) Name() string { return "atr_" + strconv.Itoa(a.period) }
+
+func (a *atr) Update(k memorystore.Kline) {
+	high, low, c := k.High.Float64(), k.Low.Float64(), k.Close.Float64()
+	tr := high - low
+	if a.count > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(high-a.prevClose), math.Abs(low-a.prevClose)))
+	}
+	a.prevClose = c
+
+	a.count++
+	n := float64(a.period)
+	if a.count <= a.period {
+		a.value += tr / n
+		return
+	}
+	a.value = (a.value*(n-1) + tr) / n
+}
+
+func (a *atr) Values() map[string]float64 {
+	if a.count < a.period {
+		return nil
+	}
+	return map[string]float64{a.Name(): a.value}
+}
+
+// vwap is the volume-weighted average price since 00:00 UTC of the candle's day,
+// computed from each candle's turnover and volume.
+type vwap struct {
+	day      int64
+	turnover float64
+	volume   float64
+}
+
+func (v *vwap) Name() string { return "vwap" }
+
+func (v *vwap) Update(k memorystore.Kline) {
+	day := k.Start / (24 * time.Hour).Milliseconds()
+	if day != v.day {
+		v.day, v.turnover, v.volume = day, 0, 0
+	}
+	v.turnover += k.Turnover.Float64()
+	v.volume += k.Volume.Float64()
+}
+
+func (v *vwap) Values() map[string]float64 {
+	if v.volume == 0 {
+		return nil
+	}
+	return map[string]float64{v.Name(): v.turnover / v.volume}
+}
+
+// bollinger holds the simple moving average of the last period closes and bands
+// width population standard deviations above and below it.
+type bollinger struct {
+	period int
+	width  float64
+	closes window
+}
+
+func (b *bollinger) Name() string {
+	return "bb_" + strconv.Itoa(b.period) + "_" + strconv.FormatFloat(b.width, 'f', -1, 64)
+}
+
+func (b *bollinger) Update(k memorystore.Kline) {
+	b.closes.push(k.Close.Float64(), b.period)
+}
+
+func (b *bollinger) Values() map[string]float64 {
+	if b.closes.len() < b.period {
+		return nil
+	}
+	mean, sd := b.closes.meanStdDev(0)
+	name := b.Name()
+	return map[string]float64{
+		name + "_middle": mean,
+		name + "_upper":  mean + b.width*sd,
+		name + "_lower":  mean - b.width*sd,
+	}
+}
+
+// volatility is the sample standard deviation of the last period log returns,
+// per candle (not annualized).
+type volatility struct {
+	period    int
+	prevClose float64
+	returns   window
+}
+
+func (v *volatility) Name() string { return "volatility_" + strconv.Itoa(v.period) }
+
+func (v *volatility) Update(k memorystore.Kline) {
+	c := k.Close.Float64()
+	if v.prevClose > 0 && c > 0 {
+		v.returns.push(math.Log(c/v.prevClose), v.period)
+	}
+	v.prevClose = c
+}
+
+func (v *volatility) Values() map[string]float64 {
+	if v.returns.len() < v.period {
+		return nil
+	}
+	_, sd := v.returns.meanStdDev(1)
+	return map[string]float64{v.Name(): sd}
+}
+
+// window keeps the last n values. Statistics are recomputed from the values on
+// demand so that floating-point error does not accumulate over long runs.
+type window struct {
+	values []float64
+}
+
+func (w *window) push(x float64, n int) {
+	if len(w.values) == n {
+		copy(w.values, w.values[1:])
+		w.values = w.values[:n-1]
+	}
+	w.values = append(w.values, x)
+}
+
+func (w *window) len() int { return len(w.values) }
+
+// meanStdDev returns the mean and the standard deviation with ddof delta degrees of freedom.
+func (w *window) meanStdDev(ddof int) (float64, float64) {
+	var sum float64
+	for _, x := range w.values {
+		sum += x
+	}
+	mean := sum / float64(len(w.values))
+
+	var sq float64
+	for _, x := range w.values {
+		sq += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(w.values)-ddof))
+}
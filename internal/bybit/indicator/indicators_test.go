@@ -0,0 +1,124 @@
+package indicator
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
+
+	"go.uber.org/zap"
+)
+
+func candle(i int, open, high, low, close float64) memorystore.Kline {
+	f := func(v float64) decimal.Decimal { return decimal.MustParse(strconv.FormatFloat(v, 'f', -1, 64)) }
+	return memorystore.Kline{
+		Start:     int64(i) * 60000,
+		Interval:  "1m",
+		Open:      f(open),
+		High:      f(high),
+		Low:       f(low),
+		Close:     f(close),
+		Volume:    f(10),
+		Turnover:  f(10 * close),
+		Confirm:   true,
+		Timestamp: int64(i) * 60000,
+	}
+}
+
+func feed(t *testing.T, spec config.IndicatorSpec, closes ...float64) map[string]float64 {
+	t.Helper()
+	ind, err := New(spec)
+	if err != nil {
+		t.Fatalf("New(%+v): %v", spec, err)
+	}
+	for i, c := range closes {
+		ind.Update(candle(i, c, c+1, c-1, c))
+	}
+	return ind.Values()
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+// go test -v --run TestIndicators
+func TestIndicators(t *testing.T) {
+	if v := feed(t, config.IndicatorSpec{Type: "ema", Period: 3}, 1, 2); v != nil {
+		t.Errorf("ema: expected no value before period, got %v", v)
+	}
+	// seed = (1+2+3)/3 = 2, then 2 + 0.5*(6-2) = 4
+	if v := feed(t, config.IndicatorSpec{Type: "ema", Period: 3}, 1, 2, 3, 6); !near(v["ema_3"], 4) {
+		t.Errorf("ema: expected 4, got %v", v)
+	}
+
+	if v := feed(t, config.IndicatorSpec{Type: "rsi", Period: 3}, 1, 2, 3, 4); !near(v["rsi_3"], 100) {
+		t.Errorf("rsi: expected 100 for a rising series, got %v", v)
+	}
+	// gains 1,1 and loss 2 over 3 changes: avg gain 2/3, avg loss 2/3 -> 50
+	if v := feed(t, config.IndicatorSpec{Type: "rsi", Period: 3}, 1, 2, 3, 1); !near(v["rsi_3"], 50) {
+		t.Errorf("rsi: expected 50, got %v", v)
+	}
+
+	// true range is high-low = 2 for each candle, plus gaps from the previous close
+	if v := feed(t, config.IndicatorSpec{Type: "atr", Period: 2}, 10, 10, 14); !near(v["atr_2"], 3.5) {
+		t.Errorf("atr: expected 3.5, got %v", v)
+	}
+
+	if v := feed(t, config.IndicatorSpec{Type: "vwap"}, 10, 20); !near(v["vwap"], 15) {
+		t.Errorf("vwap: expected 15, got %v", v)
+	}
+
+	v := feed(t, config.IndicatorSpec{Type: "bollinger", Period: 2}, 100, 1, 3)
+	if !near(v["bb_2_2_middle"], 2) || !near(v["bb_2_2_upper"], 4) || !near(v["bb_2_2_lower"], 0) {
+		t.Errorf("bollinger: unexpected bands %v", v)
+	}
+
+	if v := feed(t, config.IndicatorSpec{Type: "volatility", Period: 2}, 1, 2, 4); !near(v["volatility_2"], 0) {
+		t.Errorf("volatility: expected 0 for constant log returns, got %v", v)
+	}
+
+	if _, err := New(config.IndicatorSpec{Type: "macd", Period: 3}); err == nil {
+		t.Error("expected unsupported type error")
+	}
+	if _, err := New(config.IndicatorSpec{Type: "ema"}); err == nil {
+		t.Error("expected missing period error")
+	}
+}
+
+// go test -v --run TestEngineCatchesUp
+func TestEngineCatchesUp(t *testing.T) {
+	store := memorystore.NewKlineStore(memorystore.KlineRetention{})
+	engine := NewEngine(store, func(symbol, interval string) []config.IndicatorSpec {
+		if interval != "1m" {
+			return nil
+		}
+		return []config.IndicatorSpec{{Type: "ema", Period: 2}}
+	}, nil, zap.NewNop())
+
+	// History already in the store primes the series on the first applied candle
+	for i, c := range []float64{1, 3, 5} {
+		store.Add(memorystore.KlineMemory{Symbol: "BTCUSDT", Kline: candle(i, c, c, c, c)})
+	}
+	last := memorystore.KlineMemory{Symbol: "BTCUSDT", Kline: candle(3, 7, 7, 7, 7)}
+	store.Add(last)
+
+	snap, ok := engine.Apply(last)
+	// seed (1+3)/2 = 2, then 2 + 2/3*(5-2) = 4, then 4 + 2/3*(7-4) = 6
+	if !ok || !near(snap.Values["ema_2"], 6) {
+		t.Fatalf("unexpected snapshot: %+v, %v", snap, ok)
+	}
+	if _, ok := engine.Apply(last); ok {
+		t.Error("expected an already applied candle to be ignored")
+	}
+
+	other := memorystore.KlineMemory{Symbol: "BTCUSDT", Kline: candle(3, 7, 7, 7, 7)}
+	other.Interval = "5m"
+	if _, ok := engine.Apply(other); ok {
+		t.Error("expected a series without indicators to be skipped")
+	}
+
+	if got, ok := engine.Get("BTCUSDT", "1m"); !ok || got.Start != last.Start {
+		t.Errorf("unexpected Get result: %+v, %v", got, ok)
+	}
+}
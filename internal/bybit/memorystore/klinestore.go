@@ -1,74 +1,241 @@
 package memorystore
 
 import (
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 )
 
+// KlineRetention bounds how many klines MemoryKlineStore keeps per symbol and interval.
+// A zero MaxCount or MaxAge disables that limit.
+type KlineRetention struct {
+	MaxCount int           // newest klines kept per symbol and interval
+	MaxAge   time.Duration // klines starting earlier than the newest kline minus MaxAge are evicted
+}
+
+// KlineStoreStats reports the size of MemoryKlineStore and how much it has evicted.
+type KlineStoreStats struct {
+	Symbols        int
+	Series         int // symbol/interval pairs
+	Klines         int
+	ApproxBytes    int64
+	Duplicates     int64 // adds that replaced an already stored candle
+	EvictedByCount int64
+	EvictedByAge   int64
+	EvictedSymbols int64 // symbols dropped because they left the symbol set
+}
+
+// SeriesKey identifies one symbol's klines at one interval.
+type SeriesKey struct {
+	Symbol   string
+	Interval string
+}
+
+// MemoryKlineStore keeps confirmed klines per symbol and interval, ordered and unique by Start.
 type MemoryKlineStore struct {
-	globalMu sync.RWMutex
-	data     map[string]*symbolKlineStore
+	globalMu  sync.RWMutex
+	data      map[SeriesKey]*symbolKlineStore
+	retention KlineRetention
+
+	duplicates     atomic.Int64
+	evictedByCount atomic.Int64
+	evictedByAge   atomic.Int64
+	evictedSymbols atomic.Int64
+
+	subMu     sync.RWMutex
+	subs      map[int]*KlineSubscription
+	nextSubID int
+	closed    bool
 }
 
 type symbolKlineStore struct {
 	mu     sync.Mutex
-	klines []Kline
+	klines *klineRing
+	bytes  int64
 }
 
-func NewKlineStore() *MemoryKlineStore {
+func NewKlineStore(retention KlineRetention) *MemoryKlineStore {
 	return &MemoryKlineStore{
-		data: make(map[string]*symbolKlineStore),
+		data:      make(map[SeriesKey]*symbolKlineStore),
+		retention: retention,
+		subs:      make(map[int]*KlineSubscription),
+	}
+}
+
+// Add stores a kline in order of Start. A kline with the same Start as a stored one
+// replaces it, so re-delivered candles (e.g., after a resubscribe) are not duplicated.
+// It reports whether the kline was new; new klines are published to subscribers.
+func (s *MemoryKlineStore) Add(k KlineMemory) bool {
+	if !s.add(k) {
+		return false
 	}
+	s.publish(k)
+	return true
 }
 
-func (s *MemoryKlineStore) Add(k KlineMemory) {
-	// Fast path: lock per-symbol store only
+func (s *MemoryKlineStore) add(k KlineMemory) bool {
+	key := SeriesKey{Symbol: k.Symbol, Interval: k.Interval}
+
+	// Fast path: lock per-series store only
 	s.globalMu.RLock()
-	store, ok := s.data[k.Symbol]
+	store, ok := s.data[key]
 	s.globalMu.RUnlock()
 
 	if !ok {
-		// Need to initialize new symbol store (exclusive lock)
+		// Need to initialize new series store (exclusive lock)
 		s.globalMu.Lock()
-		if store, ok = s.data[k.Symbol]; !ok {
-			store = &symbolKlineStore{}
-			s.data[k.Symbol] = store
+		if store, ok = s.data[key]; !ok {
+			store = &symbolKlineStore{klines: newKlineRing(s.retention.MaxCount)}
+			s.data[key] = store
 		}
 		s.globalMu.Unlock()
 	}
 
-	// Per-symbol locking
+	// Per-series locking
 	store.mu.Lock()
-	store.klines = append(store.klines, k.Kline)
-	store.mu.Unlock()
+	defer store.mu.Unlock()
+
+	ring := store.klines
+	i := ring.Search(k.Start)
+	if i < ring.Len() && ring.At(i).Start == k.Start {
+		store.bytes += klineSize(k.Kline) - klineSize(ring.At(i))
+		ring.Set(i, k.Kline)
+		s.duplicates.Add(1)
+		return false
+	}
+
+	full := s.retention.MaxCount > 0 && ring.Len() == s.retention.MaxCount
+	if full && i == 0 {
+		s.evictedByCount.Add(1) // older than everything retained
+		return false
+	}
+	if full {
+		store.bytes -= klineSize(ring.At(0))
+	}
+	if ring.Insert(i, k.Kline) {
+		s.evictedByCount.Add(1)
+	}
+	store.bytes += klineSize(k.Kline)
+
+	if s.retention.MaxAge > 0 {
+		cutoff := ring.At(ring.Len()-1).Start - s.retention.MaxAge.Milliseconds()
+		for ring.Len() > 0 && ring.At(0).Start < cutoff {
+			store.bytes -= klineSize(ring.At(0))
+			ring.PopFront()
+			s.evictedByAge.Add(1)
+		}
+	}
+	return true
 }
 
-func (s *MemoryKlineStore) GetBySymbol(symbol string) []Kline {
-	s.globalMu.RLock()
-	store, ok := s.data[symbol]
-	s.globalMu.RUnlock()
-	if !ok {
+// Range returns a copy of a series' klines with Start in [from, to), in milliseconds.
+func (s *MemoryKlineStore) Range(symbol, interval string, from, to int64) []Kline {
+	store := s.series(symbol, interval)
+	if store == nil {
 		return nil
 	}
 
 	store.mu.Lock()
 	defer store.mu.Unlock()
 
-	cp := make([]Kline, len(store.klines))
-	copy(cp, store.klines)
-	return cp
+	lo := store.klines.Search(from)
+	hi := store.klines.Search(to)
+	if lo >= hi {
+		return nil
+	}
+	return store.klines.Copy(lo, hi)
 }
 
-func (s *MemoryKlineStore) GetAll() map[string][]Kline {
+// Latest returns a copy of the n newest klines of a series, oldest first.
+func (s *MemoryKlineStore) Latest(symbol, interval string, n int) []Kline {
+	store := s.series(symbol, interval)
+	if store == nil || n <= 0 {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	size := store.klines.Len()
+	if n > size {
+		n = size
+	}
+	return store.klines.Copy(size-n, size)
+}
+
+// At returns the kline of a series that starts exactly at ts (milliseconds).
+func (s *MemoryKlineStore) At(symbol, interval string, ts int64) (Kline, bool) {
+	store := s.series(symbol, interval)
+	if store == nil {
+		return Kline{}, false
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	i := store.klines.Search(ts)
+	if i < store.klines.Len() && store.klines.At(i).Start == ts {
+		return store.klines.At(i), true
+	}
+	return Kline{}, false
+}
+
+// GetSeries returns a copy of every kline of one symbol at one interval, ordered by Start.
+func (s *MemoryKlineStore) GetSeries(symbol, interval string) []Kline {
+	store := s.series(symbol, interval)
+	if store == nil {
+		return nil
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.klines.Slice()
+}
+
+// GetBySymbol returns a copy of a symbol's klines across all intervals,
+// grouped by interval and ordered by Start within each interval.
+func (s *MemoryKlineStore) GetBySymbol(symbol string) []Kline {
 	s.globalMu.RLock()
 	defer s.globalMu.RUnlock()
 
-	result := make(map[string][]Kline, len(s.data))
-	for sym, store := range s.data {
+	var keys []SeriesKey
+	for key := range s.data {
+		if key.Symbol == symbol {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Interval < keys[j].Interval })
+
+	var out []Kline
+	for _, key := range keys {
+		store := s.data[key]
 		store.mu.Lock()
-		cp := make([]Kline, len(store.klines))
-		copy(cp, store.klines)
+		out = append(out, store.klines.Slice()...)
 		store.mu.Unlock()
-		result[sym] = cp
+	}
+	return out
+}
+
+// GetAll returns a copy of every symbol's klines, as GetBySymbol would return them.
+func (s *MemoryKlineStore) GetAll() map[string][]Kline {
+	symbols := make(map[string]struct{})
+	s.globalMu.RLock()
+	for key := range s.data {
+		symbols[key.Symbol] = struct{}{}
+	}
+	s.globalMu.RUnlock()
+
+	result := make(map[string][]Kline, len(symbols))
+	for sym := range symbols {
+		if klines := s.GetBySymbol(sym); klines != nil {
+			result[sym] = klines
+		}
 	}
 	return result
 }
@@ -81,8 +248,66 @@ func (s *MemoryKlineStore) CountAll() int {
 	total := 0
 	for _, store := range s.data {
 		store.mu.Lock()
-		total += len(store.klines)
+		total += store.klines.Len()
 		store.mu.Unlock()
 	}
 	return total
 }
+
+// RetainSymbols drops every symbol not in the given list, e.g. after the symbol set shrinks.
+func (s *MemoryKlineStore) RetainSymbols(symbols []string) {
+	keep := make(map[string]struct{}, len(symbols))
+	for _, sym := range symbols {
+		keep[sym] = struct{}{}
+	}
+
+	s.globalMu.Lock()
+	defer s.globalMu.Unlock()
+
+	dropped := make(map[string]struct{})
+	for key := range s.data {
+		if _, ok := keep[key.Symbol]; !ok {
+			delete(s.data, key)
+			dropped[key.Symbol] = struct{}{}
+		}
+	}
+	s.evictedSymbols.Add(int64(len(dropped)))
+}
+
+// Stats returns the current size of the store and its eviction counters.
+func (s *MemoryKlineStore) Stats() KlineStoreStats {
+	s.globalMu.RLock()
+	defer s.globalMu.RUnlock()
+
+	stats := KlineStoreStats{
+		Series:         len(s.data),
+		Duplicates:     s.duplicates.Load(),
+		EvictedByCount: s.evictedByCount.Load(),
+		EvictedByAge:   s.evictedByAge.Load(),
+		EvictedSymbols: s.evictedSymbols.Load(),
+	}
+	symbols := make(map[string]struct{})
+	for key, store := range s.data {
+		symbols[key.Symbol] = struct{}{}
+		store.mu.Lock()
+		stats.Klines += store.klines.Len()
+		stats.ApproxBytes += store.bytes
+		store.mu.Unlock()
+	}
+	stats.Symbols = len(symbols)
+	return stats
+}
+
+func (s *MemoryKlineStore) series(symbol, interval string) *symbolKlineStore {
+	s.globalMu.RLock()
+	defer s.globalMu.RUnlock()
+	return s.data[SeriesKey{Symbol: symbol, Interval: interval}]
+}
+
+// klineSize approximates the memory held by one kline, including its strings.
+func klineSize(k Kline) int64 {
+	return int64(unsafe.Sizeof(k)) +
+		int64(len(k.Interval)+len(k.PriceType)) +
+		int64(len(k.Open.String())+len(k.Close.String())+len(k.High.String())+len(k.Low.String())) +
+		int64(len(k.Volume.String())+len(k.Turnover.String()))
+}
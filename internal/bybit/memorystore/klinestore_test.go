@@ -0,0 +1,80 @@
+package memorystore
+
+import (
+	"testing"
+	"time"
+)
+
+// go test -v --run TestKlineStoreRetention
+func TestKlineStoreRetention(t *testing.T) {
+	s := NewKlineStore(KlineRetention{MaxCount: 3, MaxAge: 10 * time.Minute})
+
+	for i := int64(0); i < 5; i++ {
+		s.Add(KlineMemory{Symbol: "BTCUSDT", Kline: Kline{Start: i * 60000, Interval: "1m"}})
+	}
+	got := s.GetBySymbol("BTCUSDT")
+	if len(got) != 3 || got[0].Start != 120000 || got[2].Start != 240000 {
+		t.Fatalf("unexpected klines after count eviction: %+v", got)
+	}
+
+	// A kline 20 minutes later ages out everything before it
+	s.Add(KlineMemory{Symbol: "BTCUSDT", Kline: Kline{Start: 24 * 60000, Interval: "1m"}})
+	if got := s.GetBySymbol("BTCUSDT"); len(got) != 1 {
+		t.Fatalf("unexpected klines after age eviction: %+v", got)
+	}
+
+	// Returned slices are copies
+	got = s.GetBySymbol("BTCUSDT")
+	got[0].Start = -1
+	if s.GetBySymbol("BTCUSDT")[0].Start == -1 {
+		t.Error("GetBySymbol must return a copy")
+	}
+
+	s.Add(KlineMemory{Symbol: "ETHUSDT", Kline: Kline{Start: 0, Interval: "1m"}})
+	s.RetainSymbols([]string{"ETHUSDT"})
+
+	stats := s.Stats()
+	if stats.Symbols != 1 || stats.Klines != 1 || stats.EvictedByCount != 3 ||
+		stats.EvictedByAge != 2 || stats.EvictedSymbols != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// go test -v --run TestKlineStoreQueries
+func TestKlineStoreQueries(t *testing.T) {
+	s := NewKlineStore(KlineRetention{})
+
+	// Out of order, with a duplicate and a second interval
+	for _, start := range []int64{0, 120000, 60000, 180000, 120000} {
+		s.Add(KlineMemory{Symbol: "BTCUSDT", Kline: Kline{Start: start, Interval: "1m"}})
+	}
+	s.Add(KlineMemory{Symbol: "BTCUSDT", Kline: Kline{Start: 0, Interval: "5m"}})
+
+	series := s.GetSeries("BTCUSDT", "1m")
+	if len(series) != 4 {
+		t.Fatalf("expected 4 unique klines, got %d", len(series))
+	}
+	for i := 1; i < len(series); i++ {
+		if series[i-1].Start >= series[i].Start {
+			t.Fatalf("klines not ordered by start: %+v", series)
+		}
+	}
+
+	if got := s.Range("BTCUSDT", "1m", 60000, 180000); len(got) != 2 || got[0].Start != 60000 {
+		t.Errorf("unexpected range: %+v", got)
+	}
+	if got := s.Latest("BTCUSDT", "1m", 2); len(got) != 2 || got[1].Start != 180000 {
+		t.Errorf("unexpected latest: %+v", got)
+	}
+	if _, ok := s.At("BTCUSDT", "1m", 120000); !ok {
+		t.Error("expected kline at 120000")
+	}
+	if _, ok := s.At("BTCUSDT", "5m", 60000); ok {
+		t.Error("expected no 5m kline at 60000")
+	}
+
+	stats := s.Stats()
+	if stats.Series != 2 || stats.Klines != 5 || stats.Duplicates != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
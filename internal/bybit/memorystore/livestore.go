@@ -0,0 +1,114 @@
+package memorystore
+
+import "sync"
+
+// LiveKey identifies a forming candle by symbol and interval.
+type LiveKey struct {
+	Symbol   string
+	Interval string
+}
+
+// MemoryLiveStore keeps the latest in-progress (unconfirmed) candle per symbol and interval.
+// Watchers receive every change; a confirmed candle removes the forming one and is
+// delivered with Confirm set so watchers can tell the candle closed.
+type MemoryLiveStore struct {
+	mu       sync.RWMutex
+	live     map[LiveKey]Kline
+	closed   map[LiveKey]int64 // start of the last confirmed candle
+	watchers map[int]chan KlineMemory
+	nextID   int
+}
+
+func NewLiveStore() *MemoryLiveStore {
+	return &MemoryLiveStore{
+		live:     make(map[LiveKey]Kline),
+		closed:   make(map[LiveKey]int64),
+		watchers: make(map[int]chan KlineMemory),
+	}
+}
+
+// Update applies a kline update. Unconfirmed klines replace the stored forming candle
+// unless they are older; a confirmed kline clears it. It reports whether anything changed.
+func (s *MemoryLiveStore) Update(k KlineMemory) bool {
+	key := LiveKey{Symbol: k.Symbol, Interval: k.Interval}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, ok := s.live[key]
+	if k.Confirm {
+		if k.Start > s.closed[key] {
+			s.closed[key] = k.Start
+		}
+		if !ok || cur.Start > k.Start {
+			return false // nothing forming, or a newer candle already started
+		}
+		delete(s.live, key)
+	} else {
+		if k.Start <= s.closed[key] {
+			return false // late update for a candle that already closed
+		}
+		if ok && (k.Start < cur.Start || (k.Start == cur.Start && k.Timestamp < cur.Timestamp)) {
+			return false // stale update
+		}
+		s.live[key] = k.Kline
+	}
+
+	s.notifyUnlocked(k)
+	return true
+}
+
+// Get returns the forming candle for a symbol and interval, if any.
+func (s *MemoryLiveStore) Get(symbol, interval string) (Kline, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	k, ok := s.live[LiveKey{Symbol: symbol, Interval: interval}]
+	return k, ok
+}
+
+// GetAll returns a copy of every forming candle.
+func (s *MemoryLiveStore) GetAll() map[LiveKey]Kline {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[LiveKey]Kline, len(s.live))
+	for key, k := range s.live {
+		result[key] = k
+	}
+	return result
+}
+
+// Watch returns a channel of live candle changes and a function to stop watching.
+// Sends never block: when the buffer is full the change is dropped, and the watcher
+// can always read the current state with Get.
+func (s *MemoryLiveStore) Watch(buffer int) (<-chan KlineMemory, func()) {
+	ch := make(chan KlineMemory, buffer)
+
+	s.mu.Lock()
+	id := s.nextID
+	s.nextID++
+	s.watchers[id] = ch
+	s.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.watchers, id)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// notifyUnlocked sends a change to every watcher. The caller must hold s.mu.
+func (s *MemoryLiveStore) notifyUnlocked(k KlineMemory) {
+	for _, ch := range s.watchers {
+		select {
+		case ch <- k:
+		default:
+		}
+	}
+}
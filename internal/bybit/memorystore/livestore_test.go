@@ -0,0 +1,43 @@
+package memorystore
+
+import "testing"
+
+// go test -v --run TestLiveStoreUpdate
+func TestLiveStoreUpdate(t *testing.T) {
+	s := NewLiveStore()
+	ch, cancel := s.Watch(4)
+	defer cancel()
+
+	forming := KlineMemory{Symbol: "BTCUSDT", Kline: Kline{Start: 60000, Interval: "1m", Timestamp: 2}}
+	if !s.Update(forming) {
+		t.Fatal("expected forming candle to be stored")
+	}
+	if got, ok := s.Get("BTCUSDT", "1m"); !ok || got.Timestamp != 2 {
+		t.Fatalf("unexpected live candle: %+v, %v", got, ok)
+	}
+
+	stale := forming
+	stale.Timestamp = 1
+	if s.Update(stale) {
+		t.Error("expected stale update to be ignored")
+	}
+
+	confirmed := forming
+	confirmed.Confirm = true
+	if !s.Update(confirmed) {
+		t.Fatal("expected confirmed candle to clear the forming one")
+	}
+	if _, ok := s.Get("BTCUSDT", "1m"); ok {
+		t.Error("expected no live candle after confirm")
+	}
+
+	late := forming
+	late.Timestamp = 3
+	if s.Update(late) {
+		t.Error("expected late update for a closed candle to be ignored")
+	}
+
+	if len(ch) != 2 {
+		t.Errorf("expected 2 notifications, got %d", len(ch))
+	}
+}
@@ -0,0 +1,133 @@
+package memorystore
+
+import "sort"
+
+// klineRing is a FIFO of klines, kept ordered by Start by its users. With a positive capacity it is a fixed-size ring
+// buffer that overwrites its oldest entry when full; with zero capacity it grows without bound. A fixed-size ring
+// starts empty and grows like a slice until it first holds capacity entries, so idle series cost almost nothing.
+type klineRing struct {
+	buf      []Kline
+	head     int // index of the oldest entry
+	size     int
+	capacity int
+}
+
+func newKlineRing(capacity int) *klineRing {
+	return &klineRing{capacity: capacity}
+}
+
+// wrapping reports whether buf has reached its fixed capacity and is used as a ring.
+// Before that buf holds exactly the entries, oldest first.
+func (r *klineRing) wrapping() bool {
+	return r.capacity > 0 && len(r.buf) == r.capacity
+}
+
+func (r *klineRing) Len() int {
+	return r.size
+}
+
+// At returns the i-th oldest entry.
+func (r *klineRing) At(i int) Kline {
+	return r.buf[r.index(i)]
+}
+
+// Push appends k and reports whether the oldest entry was overwritten to make room.
+func (r *klineRing) Push(k Kline) bool {
+	if !r.wrapping() {
+		if r.capacity > 0 && len(r.buf) == cap(r.buf) {
+			// Grow like append would, but never past capacity
+			grown := make([]Kline, len(r.buf), min(max(2*len(r.buf), 16), r.capacity))
+			copy(grown, r.buf)
+			r.buf = grown
+		}
+		r.buf = append(r.buf, k)
+		r.size++
+		return false
+	}
+
+	if r.size < r.capacity {
+		r.buf[r.index(r.size)] = k
+		r.size++
+		return false
+	}
+
+	r.buf[r.head] = k
+	r.head = (r.head + 1) % r.capacity
+	return true
+}
+
+// Set replaces the i-th oldest entry.
+func (r *klineRing) Set(i int, k Kline) {
+	r.buf[r.index(i)] = k
+}
+
+// Insert places k so it becomes the i-th oldest entry, shifting newer entries back.
+// A full fixed-size ring drops its oldest entry (or k, if k would be the oldest);
+// it reports whether an entry was dropped.
+func (r *klineRing) Insert(i int, k Kline) bool {
+	if i == r.size {
+		return r.Push(k)
+	}
+
+	dropped := false
+	if r.capacity > 0 && r.size == r.capacity {
+		if i == 0 {
+			return true // older than everything retained; k itself is dropped
+		}
+		r.PopFront()
+		i--
+		dropped = true
+	}
+
+	r.Push(Kline{}) // grow by one slot at the back
+	for j := r.size - 1; j > i; j-- {
+		r.Set(j, r.At(j-1))
+	}
+	r.Set(i, k)
+	return dropped
+}
+
+// Search returns the index of the first entry whose Start is at least start,
+// or Len() if there is none. Entries must be ordered by Start.
+func (r *klineRing) Search(start int64) int {
+	return sort.Search(r.size, func(i int) bool {
+		return r.At(i).Start >= start
+	})
+}
+
+// PopFront removes the oldest entry.
+func (r *klineRing) PopFront() {
+	if r.size == 0 {
+		return
+	}
+
+	if !r.wrapping() {
+		r.buf[0] = Kline{}
+		r.buf = r.buf[1:]
+	} else {
+		r.buf[r.head] = Kline{}
+		r.head = (r.head + 1) % r.capacity
+	}
+	r.size--
+}
+
+// Slice returns a copy of the entries, oldest first.
+func (r *klineRing) Slice() []Kline {
+	return r.Copy(0, r.size)
+}
+
+// Copy returns a copy of the entries with index in [from, to).
+func (r *klineRing) Copy(from, to int) []Kline {
+	out := make([]Kline, to-from)
+	for i := range out {
+		out[i] = r.At(from + i)
+	}
+	return out
+}
+
+func (r *klineRing) index(i int) int {
+	if !r.wrapping() {
+		return i
+	}
+	return (r.head + i) % r.capacity
+}
@@ -0,0 +1,45 @@
+package memorystore
+
+import "testing"
+
+func ringStarts(r *klineRing) []int64 {
+	var starts []int64
+	for _, k := range r.Slice() {
+		starts = append(starts, k.Start)
+	}
+	return starts
+}
+
+// go test -v --run TestKlineRingGrows
+func TestKlineRingGrows(t *testing.T) {
+	r := newKlineRing(40)
+	if cap(r.buf) != 0 {
+		t.Fatalf("empty ring allocated %d slots", cap(r.buf))
+	}
+
+	r.Push(Kline{Start: 0})
+	if cap(r.buf) > 16 {
+		t.Errorf("ring with one entry allocated %d slots", cap(r.buf))
+	}
+
+	// Pop while growing, then fill past capacity so it wraps
+	r.PopFront()
+	for i := int64(1); i <= 45; i++ {
+		r.Push(Kline{Start: i})
+	}
+	if cap(r.buf) != 40 || r.Len() != 40 {
+		t.Fatalf("full ring has %d entries in %d slots, want 40 in 40", r.Len(), cap(r.buf))
+	}
+	if starts := ringStarts(r); starts[0] != 6 || starts[39] != 45 {
+		t.Errorf("unexpected entries after wrapping: %v", starts)
+	}
+
+	// Insert into a full ring drops the oldest entry
+	r.Set(39, Kline{Start: 46})
+	if !r.Insert(39, Kline{Start: 45}) {
+		t.Error("expected an entry dropped from a full ring")
+	}
+	if starts := ringStarts(r); starts[0] != 7 || starts[38] != 45 || starts[39] != 46 {
+		t.Errorf("unexpected entries after insert: %v", starts)
+	}
+}
@@ -0,0 +1,177 @@
+package memorystore
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State file layout: an 8-byte magic, a big-endian uint32 format version, a CRC-32C
+// (Castagnoli) checksum of the payload, the payload length as uint64, then the payload,
+// which is gzip-compressed JSON of StateSnapshot. Files are replaced atomically, so a
+// reader sees either the previous snapshot or the new one, never a partial write.
+const (
+	stateMagic   = "WSCSTATE"
+	StateVersion = 1
+
+	stateHeaderSize = len(stateMagic) + 4 + 4 + 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrStateChecksum is returned when a state file's payload does not match its checksum.
+var ErrStateChecksum = errors.New("state file checksum mismatch")
+
+// StateSnapshot is the in-memory state saved across restarts.
+type StateSnapshot struct {
+	CreatedAt int64         `json:"createdAt"` // milliseconds since epoch
+	Symbols   []string      `json:"symbols"`
+	Klines    []KlineMemory `json:"klines"`
+}
+
+// CaptureState copies the current contents of the kline and symbol stores.
+func CaptureState(klines *MemoryKlineStore, symbols *MemorySymbolStore) *StateSnapshot {
+	snap := &StateSnapshot{
+		CreatedAt: time.Now().UnixMilli(),
+		Symbols:   symbols.GetAll(),
+	}
+	for symbol, list := range klines.GetAll() {
+		for _, k := range list {
+			snap.Klines = append(snap.Klines, KlineMemory{Symbol: symbol, Kline: k})
+		}
+	}
+	return snap
+}
+
+// Restore loads the snapshot into the stores and returns the number of klines added.
+// Symbols are restored only into an empty symbol store, so a symbol set already
+// loaded from the exchange is never overwritten by an older one.
+func (snap *StateSnapshot) Restore(klines *MemoryKlineStore, symbols *MemorySymbolStore) int {
+	if symbols.Count() == 0 {
+		for _, sym := range snap.Symbols {
+			symbols.Add(sym)
+		}
+	}
+
+	added := 0
+	for _, k := range snap.Klines {
+		if klines.Add(k) {
+			added++
+		}
+	}
+	return added
+}
+
+// WriteStateFile writes snap to path atomically: it is written to a temporary file in the
+// same directory, synced, and renamed over path.
+func WriteStateFile(path string, snap *StateSnapshot) error {
+	var payload bytes.Buffer
+	zw := gzip.NewWriter(&payload)
+	if err := json.NewEncoder(zw).Encode(snap); err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress state: %w", err)
+	}
+
+	header := make([]byte, stateHeaderSize)
+	copy(header, stateMagic)
+	binary.BigEndian.PutUint32(header[8:], StateVersion)
+	binary.BigEndian.PutUint32(header[12:], crc32.Checksum(payload.Bytes(), crcTable))
+	binary.BigEndian.PutUint64(header[16:], uint64(payload.Len()))
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	w := bufio.NewWriter(tmp)
+	_, err = w.Write(header)
+	if err == nil {
+		_, err = w.Write(payload.Bytes())
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+
+	// Persist the rename itself; best effort on platforms without directory fsync
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// ReadStateFile reads and verifies a state file written by WriteStateFile.
+// A missing file is reported with an error satisfying errors.Is(err, os.ErrNotExist).
+func ReadStateFile(path string) (*StateSnapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, stateHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, fmt.Errorf("failed to read state header: %w", err)
+	}
+	if string(header[:8]) != stateMagic {
+		return nil, fmt.Errorf("not a state file: %s", path)
+	}
+	if version := binary.BigEndian.Uint32(header[8:]); version != StateVersion {
+		return nil, fmt.Errorf("unsupported state file version %d (want %d)", version, StateVersion)
+	}
+	checksum := binary.BigEndian.Uint32(header[12:])
+	size := binary.BigEndian.Uint64(header[16:])
+
+	payload, err := io.ReadAll(io.LimitReader(f, int64(size)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state payload: %w", err)
+	}
+	if uint64(len(payload)) != size {
+		return nil, fmt.Errorf("state payload is %d bytes, header says %d", len(payload), size)
+	}
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return nil, ErrStateChecksum
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress state: %w", err)
+	}
+	defer zr.Close()
+
+	var snap StateSnapshot
+	if err := json.NewDecoder(zr).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	return &snap, nil
+}
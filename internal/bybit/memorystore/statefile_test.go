@@ -0,0 +1,66 @@
+package memorystore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"wscollector/pkg/decimal"
+
+	"go.uber.org/zap"
+)
+
+// go test -v --run TestStateFileRoundTrip
+func TestStateFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "memory.snap")
+
+	klines := NewKlineStore(KlineRetention{})
+	symbols := NewSymbolStore(func(string) []string { return []string{"1"} }, zap.NewNop())
+	symbols.Add("BTCUSDT")
+	k := minuteKline("BTCUSDT", 1)
+	k.Open = decimal.MustParse("0.000120")
+	klines.Add(k)
+	klines.Add(minuteKline("BTCUSDT", 2))
+
+	if err := WriteStateFile(path, CaptureState(klines, symbols)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	snap, err := ReadStateFile(path)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+
+	restoredKlines := NewKlineStore(KlineRetention{})
+	restoredSymbols := NewSymbolStore(func(string) []string { return []string{"1"} }, zap.NewNop())
+	if n := snap.Restore(restoredKlines, restoredSymbols); n != 2 {
+		t.Errorf("expected 2 klines restored, got %d", n)
+	}
+	if !restoredSymbols.Contains("BTCUSDT") {
+		t.Error("expected symbol to be restored")
+	}
+	if got, ok := restoredKlines.At("BTCUSDT", "1m", 60000); !ok || got.Open.String() != "0.000120" {
+		t.Errorf("unexpected restored kline: %+v, %v", got, ok)
+	}
+
+	// Corrupt one payload byte
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	if _, err := ReadStateFile(path); !errors.Is(err, ErrStateChecksum) {
+		t.Errorf("expected checksum error, got %v", err)
+	}
+
+	// Unknown version
+	data[len(data)-1] ^= 0xff
+	data[11] = 99
+	os.WriteFile(path, data, 0o644)
+	if _, err := ReadStateFile(path); err == nil {
+		t.Error("expected version error")
+	}
+
+	if _, err := ReadStateFile(filepath.Join(t.TempDir(), "missing")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected not-exist error, got %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package memorystore
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SlowConsumerPolicy decides what happens when a subscriber's buffer is full.
+type SlowConsumerPolicy int
+
+const (
+	// DropNewest discards the candle that did not fit; the buffer keeps older candles.
+	DropNewest SlowConsumerPolicy = iota
+	// DropOldest discards the oldest buffered candle to make room for the new one.
+	DropOldest
+	// Disconnect closes the subscription; the consumer sees its channel closed.
+	Disconnect
+)
+
+// KlineFilter selects which candles a subscriber receives. Empty lists match everything.
+type KlineFilter struct {
+	Symbols   []string
+	Intervals []string
+}
+
+// SubscribeOptions configures a subscription's buffer and slow-consumer behavior.
+type SubscribeOptions struct {
+	Buffer int // channel capacity; values below 1 use 1
+	Policy SlowConsumerPolicy
+}
+
+// KlineSubscription delivers confirmed candles matching its filter.
+// C is closed on Unsubscribe, on store Close, or when a Disconnect-policy buffer overflows.
+type KlineSubscription struct {
+	C <-chan KlineMemory
+
+	ch        chan KlineMemory
+	store     *MemoryKlineStore
+	id        int
+	symbols   map[string]struct{}
+	intervals map[string]struct{}
+	policy    SlowConsumerPolicy
+
+	mu           sync.Mutex
+	closed       bool
+	disconnected bool
+	dropped      atomic.Int64
+}
+
+// Subscribe registers a consumer of newly stored candles. After the store is closed it
+// returns a subscription whose channel is already closed.
+func (s *MemoryKlineStore) Subscribe(filter KlineFilter, opts SubscribeOptions) *KlineSubscription {
+	if opts.Buffer < 1 {
+		opts.Buffer = 1
+	}
+
+	ch := make(chan KlineMemory, opts.Buffer)
+	sub := &KlineSubscription{
+		C:         ch,
+		ch:        ch,
+		store:     s,
+		symbols:   toSet(filter.Symbols),
+		intervals: toSet(filter.Intervals),
+		policy:    opts.Policy,
+	}
+
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+
+	if s.closed {
+		sub.closeLocked()
+		return sub
+	}
+	sub.id = s.nextSubID
+	s.nextSubID++
+	s.subs[sub.id] = sub
+	return sub
+}
+
+// Close closes every subscription and rejects new ones. Stored candles remain readable.
+func (s *MemoryKlineStore) Close() {
+	s.subMu.Lock()
+	subs := s.subs
+	s.subs = make(map[int]*KlineSubscription)
+	s.closed = true
+	s.subMu.Unlock()
+
+	for _, sub := range subs {
+		sub.mu.Lock()
+		sub.closeLocked()
+		sub.mu.Unlock()
+	}
+}
+
+// publish delivers a stored candle to every matching subscriber without blocking.
+func (s *MemoryKlineStore) publish(k KlineMemory) {
+	s.subMu.RLock()
+	if len(s.subs) == 0 {
+		s.subMu.RUnlock()
+		return
+	}
+	subs := make([]*KlineSubscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		if sub.matches(k) {
+			subs = append(subs, sub)
+		}
+	}
+	s.subMu.RUnlock()
+
+	for _, sub := range subs {
+		sub.send(k)
+	}
+}
+
+// Unsubscribe stops delivery and closes C. It is safe to call more than once.
+func (sub *KlineSubscription) Unsubscribe() {
+	sub.store.subMu.Lock()
+	delete(sub.store.subs, sub.id)
+	sub.store.subMu.Unlock()
+
+	sub.mu.Lock()
+	sub.closeLocked()
+	sub.mu.Unlock()
+}
+
+// Dropped returns how many candles were discarded because the buffer was full.
+func (sub *KlineSubscription) Dropped() int64 {
+	return sub.dropped.Load()
+}
+
+// Disconnected reports whether the subscription was closed for falling behind.
+func (sub *KlineSubscription) Disconnected() bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	return sub.disconnected
+}
+
+func (sub *KlineSubscription) matches(k KlineMemory) bool {
+	if len(sub.symbols) > 0 {
+		if _, ok := sub.symbols[k.Symbol]; !ok {
+			return false
+		}
+	}
+	if len(sub.intervals) > 0 {
+		if _, ok := sub.intervals[k.Interval]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (sub *KlineSubscription) send(k KlineMemory) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	select {
+	case sub.ch <- k:
+		return
+	default:
+	}
+
+	sub.dropped.Add(1)
+	switch sub.policy {
+	case DropOldest:
+		select {
+		case <-sub.ch:
+		default:
+		}
+		select {
+		case sub.ch <- k:
+		default:
+		}
+	case Disconnect:
+		sub.disconnected = true
+		sub.closeLocked()
+		go sub.Unsubscribe() // remove from the store without holding sub.mu
+	}
+}
+
+// closeLocked closes the channel once. The caller must hold sub.mu.
+func (sub *KlineSubscription) closeLocked() {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+}
+
+func toSet(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
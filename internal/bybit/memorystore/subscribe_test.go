@@ -0,0 +1,59 @@
+package memorystore
+
+import "testing"
+
+func minuteKline(symbol string, i int64) KlineMemory {
+	return KlineMemory{Symbol: symbol, Kline: Kline{Start: i * 60000, Interval: "1m", Confirm: true}}
+}
+
+// go test -v --run TestKlineStoreSubscribe
+func TestKlineStoreSubscribe(t *testing.T) {
+	s := NewKlineStore(KlineRetention{})
+
+	btc := s.Subscribe(KlineFilter{Symbols: []string{"BTCUSDT"}}, SubscribeOptions{Buffer: 2, Policy: DropNewest})
+	oldest := s.Subscribe(KlineFilter{Intervals: []string{"1m"}}, SubscribeOptions{Buffer: 2, Policy: DropOldest})
+	strict := s.Subscribe(KlineFilter{}, SubscribeOptions{Buffer: 1, Policy: Disconnect})
+
+	s.Add(minuteKline("BTCUSDT", 1))
+	s.Add(minuteKline("ETHUSDT", 1))
+	s.Add(minuteKline("BTCUSDT", 1)) // duplicate, not published
+	s.Add(minuteKline("BTCUSDT", 2))
+	s.Add(minuteKline("BTCUSDT", 3))
+
+	if got := (<-btc.C).Start; got != 60000 {
+		t.Errorf("DropNewest: expected first candle kept, got start %d", got)
+	}
+	if btc.Dropped() != 1 {
+		t.Errorf("DropNewest: expected 1 dropped, got %d", btc.Dropped())
+	}
+
+	if got := (<-oldest.C).Start; got != 120000 {
+		t.Errorf("DropOldest: expected start 120000 at head, got %d", got)
+	}
+	if oldest.Dropped() != 2 {
+		t.Errorf("DropOldest: expected 2 dropped, got %d", oldest.Dropped())
+	}
+
+	<-strict.C
+	if _, ok := <-strict.C; ok || !strict.Disconnected() {
+		t.Error("Disconnect: expected subscription to be closed after overflow")
+	}
+
+	btc.Unsubscribe()
+	btc.Unsubscribe()
+	for range btc.C {
+		// buffered candles stay readable until the closed channel drains
+	}
+
+	s.Close()
+	if _, ok := <-oldest.C; !ok {
+		t.Error("expected buffered candle before close")
+	}
+	if _, ok := <-oldest.C; ok {
+		t.Error("expected channel closed after store Close")
+	}
+	late := s.Subscribe(KlineFilter{}, SubscribeOptions{})
+	if _, ok := <-late.C; ok {
+		t.Error("expected subscription on a closed store to be closed")
+	}
+}
@@ -11,23 +11,38 @@ import (
 )
 
 type MemorySymbolStore struct {
-	mu          sync.Mutex
-	symbols     map[string]struct{}
-	WsInterval  string
-	klineTopics []string
-	lastHash    uint64
-	logger      *zap.Logger
+	mu           sync.Mutex
+	symbols      map[string]struct{}
+	intervalsFor func(symbol string) []string
+	klineTopics  []string
+	lastHash     uint64
+	listeners    []func(symbols []string)
+	logger       *zap.Logger
 }
 
-// Constructor: Initializes a new symbol store
-func NewSymbolStore(interval string, logger *zap.Logger) *MemorySymbolStore {
+// Constructor: Initializes a new symbol store.
+// intervalsFor returns the kline intervals (API values, e.g. "1", "60") subscribed for a symbol.
+func NewSymbolStore(intervalsFor func(symbol string) []string, logger *zap.Logger) *MemorySymbolStore {
 	return &MemorySymbolStore{
-		symbols:    make(map[string]struct{}),
-		WsInterval: interval,
-		logger:     logger,
+		symbols:      make(map[string]struct{}),
+		intervalsFor: intervalsFor,
+		logger:       logger,
 	}
 }
 
+// OnSymbolsChanged registers fn to be called with the new symbol list
+// whenever the sync worker applies a changed symbol set.
+func (s *MemorySymbolStore) OnSymbolsChanged(fn func(symbols []string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// IntervalsFor returns the kline intervals subscribed for the given symbol.
+func (s *MemorySymbolStore) IntervalsFor(symbol string) []string {
+	return s.intervalsFor(symbol)
+}
+
 // Add inserts a new symbol into the store
 func (s *MemorySymbolStore) Add(symbol string) {
 	s.mu.Lock()
@@ -68,31 +83,32 @@ func (s *MemorySymbolStore) GetAll() []string {
 	return out
 }
 
-// GetKlineTopics returns the cached list of kline stream topics.
+// GetKlineTopics returns the cached list of kline stream topics,
+// one per symbol and configured interval.
 // It only regenerates the list if the symbol set has changed.
-func (s *MemorySymbolStore) GetKlineTopics(interval string) []string {
-	return s.buildKlineTopics(interval, true)
+func (s *MemorySymbolStore) GetKlineTopics() []string {
+	return s.buildKlineTopics(true)
 }
 
 // RefreshKlineTopics forces a regeneration of the kline topic list,
 // regardless of whether the symbol set has changed.
-func (s *MemorySymbolStore) RefreshKlineTopics(interval string) []string {
-	return s.buildKlineTopics(interval, false)
+func (s *MemorySymbolStore) RefreshKlineTopics() []string {
+	return s.buildKlineTopics(false)
 }
 
 // buildKlineTopics computes the kline topics based on the current symbol set.
 // It acquires a mutex lock before accessing or updating internal state.
 // If useCache is true, it returns the cached topic list when the symbol set hasn't changed.
-func (s *MemorySymbolStore) buildKlineTopics(interval string, useCache bool) []string {
+func (s *MemorySymbolStore) buildKlineTopics(useCache bool) []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.buildKlineTopicsUnlocked(interval, useCache)
+	return s.buildKlineTopicsUnlocked(useCache)
 }
 
 // buildKlineTopicsUnlocked is the non-locking version of buildKlineTopics.
 // It assumes that the caller has already acquired the necessary mutex lock.
-func (s *MemorySymbolStore) buildKlineTopicsUnlocked(interval string, useCache bool) []string {
+func (s *MemorySymbolStore) buildKlineTopicsUnlocked(useCache bool) []string {
 
 	symbols := make([]string, 0, len(s.symbols))
 	for sym := range s.symbols {
@@ -110,14 +126,17 @@ func (s *MemorySymbolStore) buildKlineTopicsUnlocked(interval string, useCache b
 
 	topics := make([]string, 0, len(symbols))
 	for _, symbol := range symbols {
-		topics = append(topics, fmt.Sprintf("kline.%s.%s", interval, symbol))
+		for _, interval := range s.intervalsFor(symbol) {
+			topics = append(topics, fmt.Sprintf("kline.%s.%s", interval, symbol))
+		}
 	}
 
 	s.klineTopics = topics
 	s.lastHash = hash
 
 	s.logger.Info("kline topics regenerated",
-		zap.Int("total_symbols", len(topics)),
+		zap.Int("total_symbols", len(symbols)),
+		zap.Int("total_topics", len(topics)),
 		zap.Bool("forced", !useCache),
 	)
 
@@ -144,6 +163,15 @@ func (s *MemorySymbolStore) StartSymbolSyncWorker(ch <-chan string) {
 
 		newHash := computeSymbolHash(newSymbols)
 
+		// Notify listeners after the lock is released
+		var listeners []func([]string)
+		var current []string
+		defer func() {
+			for _, fn := range listeners {
+				fn(current)
+			}
+		}()
+
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
@@ -183,7 +211,12 @@ func (s *MemorySymbolStore) StartSymbolSyncWorker(ch <-chan string) {
 		)
 
 		// Rebuild kline topics (mutex must be held)
-		s.buildKlineTopicsUnlocked(s.WsInterval, false)
+		s.buildKlineTopicsUnlocked(false)
+
+		listeners = append(listeners, s.listeners...)
+		for sym := range s.symbols {
+			current = append(current, sym)
+		}
 	}()
 }
 
@@ -0,0 +1,109 @@
+package movers
+
+import (
+	"fmt"
+	"sort"
+
+	"wscollector/internal/bybit/memorystore"
+)
+
+// RankBy selects the metric a cross-section is ordered by, highest first.
+type RankBy string
+
+const (
+	RankByReturn   RankBy = "return"
+	RankByRange    RankBy = "range"
+	RankByTurnover RankBy = "turnover"
+)
+
+// ParseRankBy validates a ranking metric; an empty string means RankByReturn.
+func ParseRankBy(s string) (RankBy, error) {
+	switch r := RankBy(s); r {
+	case "":
+		return RankByReturn, nil
+	case RankByReturn, RankByRange, RankByTurnover:
+		return r, nil
+	default:
+		return "", fmt.Errorf("unsupported rank metric: %q", s)
+	}
+}
+
+// Point is a symbol's cumulative return at the close of one candle in the window.
+type Point struct {
+	Time   int64   // candle start, in milliseconds
+	Return float64 // close / window open - 1
+}
+
+// Performance summarizes one symbol over a trailing window.
+type Performance struct {
+	Symbol   string
+	Open     float64 // open of the first candle in the window
+	Close    float64 // close of the last candle in the window
+	High     float64
+	Low      float64
+	Return   float64 // Close / Open - 1
+	Range    float64 // (High - Low) / Open
+	Volume   float64
+	Turnover float64
+	Candles  int
+	Series   []Point // one point per candle, oldest first
+}
+
+// Compute summarizes klines ordered by Start. It returns false when there are no
+// klines or the first open is not positive.
+func Compute(symbol string, klines []memorystore.Kline) (Performance, bool) {
+	if len(klines) == 0 {
+		return Performance{}, false
+	}
+
+	open := klines[0].Open.Float64()
+	if open <= 0 {
+		return Performance{}, false
+	}
+
+	p := Performance{
+		Symbol:  symbol,
+		Open:    open,
+		High:    klines[0].High.Float64(),
+		Low:     klines[0].Low.Float64(),
+		Candles: len(klines),
+		Series:  make([]Point, 0, len(klines)),
+	}
+	for _, k := range klines {
+		if h := k.High.Float64(); h > p.High {
+			p.High = h
+		}
+		if l := k.Low.Float64(); l < p.Low {
+			p.Low = l
+		}
+		p.Volume += k.Volume.Float64()
+		p.Turnover += k.Turnover.Float64()
+		p.Close = k.Close.Float64()
+		p.Series = append(p.Series, Point{Time: k.Start, Return: p.Close/open - 1})
+	}
+	p.Return = p.Close/open - 1
+	p.Range = (p.High - p.Low) / open
+	return p, true
+}
+
+// Rank orders performances by the given metric, highest first, breaking ties by symbol.
+func Rank(perfs []Performance, by RankBy) {
+	metric := func(p Performance) float64 {
+		switch by {
+		case RankByRange:
+			return p.Range
+		case RankByTurnover:
+			return p.Turnover
+		default:
+			return p.Return
+		}
+	}
+
+	sort.Slice(perfs, func(i, j int) bool {
+		a, b := metric(perfs[i]), metric(perfs[j])
+		if a != b {
+			return a > b
+		}
+		return perfs[i].Symbol < perfs[j].Symbol
+	})
+}
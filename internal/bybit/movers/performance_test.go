@@ -0,0 +1,135 @@
+package movers
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
+
+	"go.uber.org/zap"
+)
+
+func minute(i int64, open, high, low, close string) memorystore.Kline {
+	return memorystore.Kline{
+		Start:    i * 60000,
+		Interval: "1m",
+		Open:     decimal.MustParse(open),
+		High:     decimal.MustParse(high),
+		Low:      decimal.MustParse(low),
+		Close:    decimal.MustParse(close),
+		Volume:   decimal.MustParse("1"),
+		Turnover: decimal.MustParse(close),
+		Confirm:  true,
+	}
+}
+
+// go test -v --run TestCompute
+func TestCompute(t *testing.T) {
+	p, ok := Compute("BTCUSDT", []memorystore.Kline{
+		minute(0, "100", "105", "95", "102"),
+		minute(1, "102", "120", "100", "110"),
+	})
+	if !ok {
+		t.Fatal("expected a performance")
+	}
+	if math.Abs(p.Return-0.10) > 1e-9 || math.Abs(p.Range-0.25) > 1e-9 || p.Volume != 2 {
+		t.Errorf("unexpected performance: %+v", p)
+	}
+	if len(p.Series) != 2 || math.Abs(p.Series[0].Return-0.02) > 1e-9 {
+		t.Errorf("unexpected series: %+v", p.Series)
+	}
+
+	if _, ok := Compute("BTCUSDT", nil); ok {
+		t.Error("expected no performance without klines")
+	}
+}
+
+// go test -v --run TestCrossSection
+func TestCrossSection(t *testing.T) {
+	store := memorystore.NewKlineStore(memorystore.KlineRetention{})
+	symbols := memorystore.NewSymbolStore(func(string) []string { return []string{"1"} }, zap.NewNop())
+	for _, sym := range []string{"AUSDT", "BUSDT", "CUSDT"} {
+		symbols.Add(sym)
+	}
+
+	store.Add(memorystore.KlineMemory{Symbol: "AUSDT", Kline: minute(0, "10", "10", "10", "10")})
+	store.Add(memorystore.KlineMemory{Symbol: "AUSDT", Kline: minute(1, "10", "11", "10", "11")})
+	store.Add(memorystore.KlineMemory{Symbol: "BUSDT", Kline: minute(0, "10", "10", "8", "9")})
+	store.Add(memorystore.KlineMemory{Symbol: "CUSDT", Kline: minute(0, "10", "10", "10", "10")})
+	store.Add(memorystore.KlineMemory{Symbol: "CUSDT", Kline: minute(2, "10", "20", "10", "20")}) // outside the window
+
+	svc, err := NewService(config.MoversConfig{}, store, symbols, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ranking, err := svc.CrossSection(context.Background(), "1m", time.UnixMilli(120000), 2*time.Minute, RankByReturn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, p := range ranking.Movers {
+		order = append(order, p.Symbol)
+	}
+	if len(order) != 3 || order[0] != "AUSDT" || order[1] != "CUSDT" || order[2] != "BUSDT" {
+		t.Errorf("unexpected ranking order: %v", order)
+	}
+
+	if _, err := NewService(config.MoversConfig{RankBy: "sharpe"}, store, symbols, nil, zap.NewNop()); err == nil {
+		t.Error("expected unsupported rank metric error")
+	}
+}
+
+func TestTopBottom(t *testing.T) {
+	svc := &Service{latest: Ranking{Movers: []Performance{{Symbol: "AUSDT"}, {Symbol: "BUSDT"}, {Symbol: "CUSDT"}}}}
+
+	if top := svc.Top(2); len(top) != 2 || top[0].Symbol != "AUSDT" {
+		t.Errorf("unexpected top: %v", top)
+	}
+	if bottom := svc.Bottom(5); len(bottom) != 3 || bottom[0].Symbol != "CUSDT" {
+		t.Errorf("unexpected bottom: %v", bottom)
+	}
+	if len(svc.Top(-1)) != 0 || len(svc.Bottom(-1)) != 0 {
+		t.Error("expected no movers for a negative count")
+	}
+}
+
+func TestScheduleMergesRefreshes(t *testing.T) {
+	store := memorystore.NewKlineStore(memorystore.KlineRetention{})
+	symbols := memorystore.NewSymbolStore(func(string) []string { return []string{"1"} }, zap.NewNop())
+	svc, err := NewService(config.MoversConfig{Settle: 20 * time.Millisecond}, store, symbols, nil, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Start()
+
+	// Historical closes are ignored; live ones within the settle time share one refresh
+	now := time.Now().Truncate(time.Minute)
+	for i := 10; i > 1; i-- {
+		store.Add(memorystore.KlineMemory{Symbol: "AUSDT", Kline: minute(now.Add(-time.Duration(i)*time.Minute).UnixMilli()/60000, "1", "1", "1", "1")})
+	}
+	store.Add(memorystore.KlineMemory{Symbol: "AUSDT", Kline: minute(now.Add(-time.Minute).UnixMilli()/60000, "1", "1", "1", "1")})
+	store.Add(memorystore.KlineMemory{Symbol: "AUSDT", Kline: minute(now.UnixMilli()/60000, "1", "1", "1", "1")})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if ranking, ok := svc.Latest(); ok {
+			if ranking.To != now.Add(time.Minute).UnixMilli() {
+				t.Errorf("ranking ends at %d, want the latest close", ranking.To)
+			}
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	svc.Stop()
+
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	if svc.timer != nil {
+		t.Error("refresh timer still set after Stop")
+	}
+}
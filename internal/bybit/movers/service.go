@@ -0,0 +1,277 @@
+package movers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// postgresChunk is how many symbols are read from Postgres per query.
+const postgresChunk = 50
+
+// Ranking is a cross-section of symbol performances over one window, ranked highest first.
+type Ranking struct {
+	Interval string
+	From     int64 // window start, in milliseconds (inclusive)
+	To       int64 // window end, in milliseconds (exclusive)
+	RankBy   RankBy
+	Movers   []Performance
+}
+
+// Service keeps a ranking of every tracked symbol over a trailing window, refreshed
+// shortly after each 1-minute candle closes. Candles come from the memory store;
+// symbols whose window is not fully in memory are read from Postgres, if configured.
+type Service struct {
+	store    *memorystore.MemoryKlineStore
+	symbols  *memorystore.MemorySymbolStore
+	postgres *postgres.PostgresClient // nil reads memory only
+	logger   *zap.Logger
+
+	interval string        // DB interval ranked, e.g. "1m"
+	window   time.Duration // trailing window length
+	rankBy   RankBy
+	settle   time.Duration // wait after the first close of a minute so other symbols' closes arrive
+
+	mu        sync.RWMutex
+	latest    Ranking
+	lastClose int64
+	sub       *memorystore.KlineSubscription
+	done      chan struct{}
+
+	// One refresh is pending at a time; closes arriving before it fires move its end
+	timer      *time.Timer
+	pendingEnd time.Time
+	stopped    bool
+	refreshing sync.WaitGroup
+}
+
+// NewService creates a ranking service from its config. Unset fields default to
+// 1m candles over 4h, ranked by return, settling for 2s.
+func NewService(cfg config.MoversConfig, store *memorystore.MemoryKlineStore, symbols *memorystore.MemorySymbolStore,
+	postgresClient *postgres.PostgresClient, logger *zap.Logger) (*Service, error) {
+	s := &Service{
+		store:    store,
+		symbols:  symbols,
+		postgres: postgresClient,
+		logger:   logger,
+		interval: cfg.Interval,
+		window:   cfg.Window,
+		settle:   cfg.Settle,
+	}
+
+	if s.interval == "" {
+		s.interval = "1m"
+	}
+	if _, err := bybit.ParseDBInterval(s.interval); err != nil {
+		return nil, err
+	}
+	if s.window <= 0 {
+		s.window = 4 * time.Hour
+	}
+	if s.settle <= 0 {
+		s.settle = 2 * time.Second
+	}
+
+	var err error
+	if s.rankBy, err = ParseRankBy(cfg.RankBy); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Start subscribes to 1-minute closes and refreshes the ranking after each minute.
+func (s *Service) Start() {
+	s.sub = s.store.Subscribe(memorystore.KlineFilter{Intervals: []string{"1m"}}, memorystore.SubscribeOptions{
+		Buffer: 1024,
+		Policy: memorystore.DropNewest, // only the minute boundary matters, not every candle
+	})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		for k := range s.sub.C {
+			end := time.UnixMilli(k.Start).Add(time.Minute)
+			if end.Before(time.Now().Add(-time.Minute)) {
+				continue // backfilled or replayed history, not a live close
+			}
+			if s.markClose(k.Start) {
+				s.schedule(end)
+			}
+		}
+	}()
+}
+
+// Stop ends the refresh loop and waits for a refresh in progress.
+func (s *Service) Stop() {
+	if s.sub == nil {
+		return
+	}
+	s.sub.Unsubscribe()
+	<-s.done
+
+	s.mu.Lock()
+	s.stopped = true
+	if s.timer != nil && s.timer.Stop() {
+		s.refreshing.Done()
+	}
+	s.timer = nil
+	s.mu.Unlock()
+	s.refreshing.Wait()
+}
+
+// schedule refreshes the ranking up to end once the minute has settled. A refresh that is
+// already pending is moved to the later end instead of adding another.
+func (s *Service) schedule(end time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	if end.After(s.pendingEnd) {
+		s.pendingEnd = end
+	}
+	if s.timer == nil {
+		s.refreshing.Add(1)
+		s.timer = time.AfterFunc(s.settle, s.firePending)
+	}
+}
+
+func (s *Service) firePending() {
+	defer s.refreshing.Done()
+
+	s.mu.Lock()
+	end := s.pendingEnd
+	s.timer = nil
+	s.mu.Unlock()
+
+	s.refresh(end)
+}
+
+// Latest returns the most recent ranking, if one was computed.
+func (s *Service) Latest() (Ranking, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latest, s.latest.Movers != nil
+}
+
+// Top returns the n best performers of the latest ranking.
+func (s *Service) Top(n int) []Performance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	movers := s.latest.Movers
+	return append([]Performance(nil), movers[:min(max(n, 0), len(movers))]...)
+}
+
+// Bottom returns the n worst performers of the latest ranking, worst first.
+func (s *Service) Bottom(n int) []Performance {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n = max(n, 0)
+	movers := s.latest.Movers
+	out := make([]Performance, 0, min(n, len(movers)))
+	for i := len(movers) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, movers[i])
+	}
+	return out
+}
+
+// CrossSection ranks every tracked symbol over the candles of interval with Start in
+// [end - window, end). It does not change the latest ranking.
+func (s *Service) CrossSection(ctx context.Context, interval string, end time.Time, window time.Duration, by RankBy) (Ranking, error) {
+	meta, err := bybit.ParseDBInterval(interval)
+	if err != nil {
+		return Ranking{}, err
+	}
+
+	from := end.Add(-window)
+	firstStart := meta.Align(from)
+	if firstStart.Before(from) {
+		firstStart = meta.Next(firstStart)
+	}
+
+	ranking := Ranking{Interval: interval, From: from.UnixMilli(), To: end.UnixMilli(), RankBy: by}
+
+	var missing []string
+	for _, symbol := range s.symbols.GetAll() {
+		klines := s.store.Range(symbol, interval, ranking.From, ranking.To)
+		if s.postgres != nil && (len(klines) == 0 || klines[0].Start > firstStart.UnixMilli()) {
+			missing = append(missing, symbol)
+			continue
+		}
+		if p, ok := Compute(symbol, klines); ok {
+			ranking.Movers = append(ranking.Movers, p)
+		}
+	}
+
+	for i := 0; i < len(missing); i += postgresChunk {
+		chunk := missing[i:min(i+postgresChunk, len(missing))]
+		records, err := s.postgres.GetKlineRange(ctx, chunk, interval, from, end)
+		if err != nil {
+			return Ranking{}, fmt.Errorf("failed to read klines: %w", err)
+		}
+
+		bySymbol := make(map[string][]memorystore.Kline)
+		for _, r := range records {
+			bySymbol[r.Symbol] = append(bySymbol[r.Symbol], postgres.FromKlineRecord(r))
+		}
+		for _, symbol := range chunk {
+			if p, ok := Compute(symbol, bySymbol[symbol]); ok {
+				ranking.Movers = append(ranking.Movers, p)
+			}
+		}
+	}
+
+	Rank(ranking.Movers, by)
+	if ranking.Movers == nil {
+		ranking.Movers = []Performance{}
+	}
+	return ranking, nil
+}
+
+// markClose records the start of a closed minute and reports whether it is a new one.
+func (s *Service) markClose(start int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if start <= s.lastClose {
+		return false
+	}
+	s.lastClose = start
+	return true
+}
+
+func (s *Service) refresh(end time.Time) {
+	began := time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	ranking, err := s.CrossSection(ctx, s.interval, end, s.window, s.rankBy)
+	if err != nil {
+		s.logger.Warn("failed to refresh movers ranking", zap.Time("end", end), zap.Error(err))
+		return
+	}
+
+	s.mu.Lock()
+	if ranking.To >= s.latest.To {
+		s.latest = ranking
+	}
+	s.mu.Unlock()
+
+	s.logger.Debug("refreshed movers ranking",
+		zap.Time("end", end),
+		zap.Int("symbols", len(ranking.Movers)),
+		zap.Duration("took", time.Since(began)),
+	)
+}
@@ -0,0 +1,280 @@
+package resample
+
+import (
+	"sync"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/decimal"
+
+	"go.uber.org/zap"
+)
+
+// verifyDepth is how many recent candles per symbol/interval are kept for native-vs-derived checks.
+const verifyDepth = 8
+
+// Resampler builds higher-timeframe candles from confirmed 1-minute candles.
+// Candles for intervals that are also collected natively from Bybit are not emitted;
+// instead they are compared against the native candles and mismatches are reported.
+type Resampler struct {
+	mu        sync.Mutex
+	targets   []bybit.KlineIntervalMeta
+	nativeFor func(symbol string) []string // DB intervals collected natively for a symbol
+	buckets   map[bucketKey]*bucket
+	started   map[bucketKey]struct{} // series that have seen a bucket since startup
+	derived   map[bucketKey][]memorystore.Kline
+	native    map[bucketKey][]memorystore.Kline
+	stats     Stats
+	logger    *zap.Logger
+}
+
+// Stats counts resampler outcomes since start.
+type Stats struct {
+	Emitted    int64 // derived candles returned for storage
+	Verified   int64 // derived candles that matched the native candle
+	Mismatched int64 // derived candles that differed from the native candle
+	Incomplete int64 // buckets discarded because 1-minute candles were missing
+}
+
+type bucketKey struct {
+	symbol   string
+	interval string
+}
+
+type bucket struct {
+	kline    memorystore.Kline
+	count    int
+	expected int // minutes in the bucket; weeks and months are not meta.Minutes long
+	lastMin  int64
+	first    bool // the series' first bucket since startup, usually joined part-way through
+}
+
+// NewResampler creates a resampler for the given DB intervals (e.g., "5m", "1h", "10m").
+// nativeFor returns the DB intervals a symbol already receives from Bybit.
+func NewResampler(intervals []string, nativeFor func(symbol string) []string, logger *zap.Logger) (*Resampler, error) {
+	r := &Resampler{
+		nativeFor: nativeFor,
+		buckets:   make(map[bucketKey]*bucket),
+		started:   make(map[bucketKey]struct{}),
+		derived:   make(map[bucketKey][]memorystore.Kline),
+		native:    make(map[bucketKey][]memorystore.Kline),
+		logger:    logger,
+	}
+
+	for _, interval := range intervals {
+		meta, err := bybit.ParseDBInterval(interval)
+		if err != nil {
+			return nil, err
+		}
+		if meta.Minutes <= 1 {
+			continue // 1m is the source interval
+		}
+		r.targets = append(r.targets, meta)
+	}
+
+	return r, nil
+}
+
+// Update feeds one confirmed candle into the resampler. 1-minute candles advance the
+// derived buckets; native candles of a target interval are checked against derived ones.
+// It returns the derived candles that closed and should be stored.
+func (r *Resampler) Update(symbol string, k memorystore.Kline) []memorystore.Kline {
+	if !k.Confirm {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if k.Interval != "1m" {
+		r.observeNative(symbol, k)
+		return nil
+	}
+
+	native := make(map[string]struct{})
+	for _, interval := range r.nativeFor(symbol) {
+		native[interval] = struct{}{}
+	}
+
+	var out []memorystore.Kline
+	for _, meta := range r.targets {
+		closed, ok := r.advance(symbol, meta, k)
+		if !ok {
+			continue
+		}
+
+		if _, isNative := native[meta.DBValue]; isNative {
+			r.observeDerived(symbol, closed)
+			continue
+		}
+
+		r.stats.Emitted++
+		out = append(out, closed)
+	}
+	return out
+}
+
+// Stats returns a snapshot of the resampler counters.
+func (r *Resampler) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// advance adds a 1-minute candle to the symbol's bucket for meta and returns the bucket's
+// candle once its last minute has arrived. Buckets with missing minutes are discarded.
+func (r *Resampler) advance(symbol string, meta bybit.KlineIntervalMeta, k memorystore.Kline) (memorystore.Kline, bool) {
+	key := bucketKey{symbol: symbol, interval: meta.DBValue}
+	bucketStart := meta.Align(time.UnixMilli(k.Start))
+	start := bucketStart.UnixMilli()
+	next := meta.Next(bucketStart).UnixMilli()
+
+	b := r.buckets[key]
+	if b != nil && b.kline.Start != start {
+		// A new bucket began before the previous one closed
+		r.discard(symbol, b, meta)
+		b = nil
+	}
+	if b != nil && k.Start <= b.lastMin {
+		return memorystore.Kline{}, false // duplicate or out-of-order minute
+	}
+
+	if b == nil {
+		_, seen := r.started[key]
+		r.started[key] = struct{}{}
+		b = &bucket{first: !seen, expected: int((next - start) / time.Minute.Milliseconds()), kline: memorystore.Kline{
+			Start:     start,
+			End:       meta.End(bucketStart).UnixMilli(),
+			Interval:  meta.DBValue,
+			PriceType: k.PriceType,
+			Open:      k.Open,
+			High:      k.High,
+			Low:       k.Low,
+			Volume:    decimal.Zero,
+			Turnover:  decimal.Zero,
+			Confirm:   true,
+		}}
+		r.buckets[key] = b
+	} else {
+		if k.High.Cmp(b.kline.High) > 0 {
+			b.kline.High = k.High
+		}
+		if k.Low.Cmp(b.kline.Low) < 0 {
+			b.kline.Low = k.Low
+		}
+	}
+
+	b.kline.Close = k.Close
+	b.kline.Timestamp = k.Timestamp
+	b.kline.Volume = b.kline.Volume.Add(k.Volume)
+	b.kline.Turnover = b.kline.Turnover.Add(k.Turnover)
+	b.count++
+	b.lastMin = k.Start
+
+	// The bucket closes with its last minute
+	if k.Start+time.Minute.Milliseconds() < next {
+		return memorystore.Kline{}, false
+	}
+	delete(r.buckets, key)
+
+	if b.count != b.expected {
+		r.discard(symbol, b, meta)
+		return memorystore.Kline{}, false
+	}
+
+	return b.kline, true
+}
+
+func (r *Resampler) discard(symbol string, b *bucket, meta bybit.KlineIntervalMeta) {
+	r.stats.Incomplete++
+
+	// Starting mid-bucket is expected after every restart, so it is not worth a warning
+	log := r.logger.Warn
+	if b.first {
+		log = r.logger.Debug
+	}
+	log("discarding incomplete derived candle",
+		zap.String("symbol", symbol),
+		zap.String("interval", meta.DBValue),
+		zap.Int64("start", b.kline.Start),
+		zap.Int("minutes", b.count),
+		zap.Int("expected", b.expected),
+	)
+}
+
+// observeDerived records a derived candle and verifies it if the native candle is already known.
+func (r *Resampler) observeDerived(symbol string, k memorystore.Kline) {
+	key := bucketKey{symbol: symbol, interval: k.Interval}
+	if native, ok := find(r.native[key], k.Start); ok {
+		r.verify(symbol, k, native)
+		return
+	}
+	r.derived[key] = push(r.derived[key], k)
+}
+
+// observeNative records a native candle and verifies it if the derived candle is already known.
+func (r *Resampler) observeNative(symbol string, k memorystore.Kline) {
+	if !r.isTarget(k.Interval) {
+		return
+	}
+
+	key := bucketKey{symbol: symbol, interval: k.Interval}
+	if derived, ok := find(r.derived[key], k.Start); ok {
+		r.verify(symbol, derived, k)
+		return
+	}
+	r.native[key] = push(r.native[key], k)
+}
+
+func (r *Resampler) verify(symbol string, derived, native memorystore.Kline) {
+	if sameCandle(derived, native) {
+		r.stats.Verified++
+		return
+	}
+
+	r.stats.Mismatched++
+	r.logger.Warn("derived candle differs from native candle",
+		zap.String("symbol", symbol),
+		zap.String("interval", native.Interval),
+		zap.Int64("start", native.Start),
+		zap.Any("derived", derived),
+		zap.Any("native", native),
+	)
+}
+
+func (r *Resampler) isTarget(interval string) bool {
+	for _, meta := range r.targets {
+		if meta.DBValue == interval {
+			return true
+		}
+	}
+	return false
+}
+
+// sameCandle compares every price and quantity exactly.
+func sameCandle(a, b memorystore.Kline) bool {
+	return a.Open.Equal(b.Open) &&
+		a.High.Equal(b.High) &&
+		a.Low.Equal(b.Low) &&
+		a.Close.Equal(b.Close) &&
+		a.Volume.Equal(b.Volume) &&
+		a.Turnover.Equal(b.Turnover)
+}
+
+func find(klines []memorystore.Kline, start int64) (memorystore.Kline, bool) {
+	for _, k := range klines {
+		if k.Start == start {
+			return k, true
+		}
+	}
+	return memorystore.Kline{}, false
+}
+
+func push(klines []memorystore.Kline, k memorystore.Kline) []memorystore.Kline {
+	klines = append(klines, k)
+	if len(klines) > verifyDepth {
+		klines = klines[len(klines)-verifyDepth:]
+	}
+	return klines
+}
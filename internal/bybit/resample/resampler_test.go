@@ -0,0 +1,114 @@
+package resample
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func minuteKline(start int64, open, high, low, closeVal string) memorystore.Kline {
+	return memorystore.Kline{
+		Start:     start,
+		End:       start + 59999,
+		Interval:  "1m",
+		PriceType: "last",
+		Open:      decimal.MustParse(open),
+		High:      decimal.MustParse(high),
+		Low:       decimal.MustParse(low),
+		Close:     decimal.MustParse(closeVal),
+		Volume:    decimal.MustParse("1"),
+		Turnover:  decimal.MustParse("10"),
+		Confirm:   true,
+	}
+}
+
+// go test -v --run TestResamplerUpdate
+func TestResamplerUpdate(t *testing.T) {
+	r, err := NewResampler([]string{"2m", "5m"}, func(string) []string { return []string{"1m", "5m"} }, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	base := int64(1745573400000) // aligned to 5 minutes
+	var emitted []memorystore.Kline
+	for i := int64(0); i < 5; i++ {
+		p := strconv.FormatInt(10+i, 10)
+		emitted = append(emitted, r.Update("BTCUSDT", minuteKline(base+i*60000, p, p, p, p))...)
+	}
+
+	// 2m buckets close at minutes 1 and 3; the 5m candle is native and only verified
+	if len(emitted) != 2 {
+		t.Fatalf("expected 2 derived candles, got %d: %+v", len(emitted), emitted)
+	}
+	first := emitted[0]
+	if first.Interval != "2m" || first.Open.String() != "10" || first.Close.String() != "11" ||
+		first.High.String() != "11" || first.Volume.String() != "2" {
+		t.Errorf("unexpected 2m candle: %+v", first)
+	}
+
+	native := memorystore.Kline{
+		Start: base, Interval: "5m", Confirm: true,
+		Open: decimal.MustParse("10"), High: decimal.MustParse("14"),
+		Low: decimal.MustParse("10"), Close: decimal.MustParse("14"),
+		Volume: decimal.MustParse("5"), Turnover: decimal.MustParse("50.0"),
+	}
+	r.Update("BTCUSDT", native)
+	native.Start += 300000
+	native.Close = decimal.MustParse("99")
+	r.Update("BTCUSDT", native)
+
+	stats := r.Stats()
+	if stats.Emitted != 2 || stats.Verified != 1 || stats.Mismatched != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// go test -v --run TestResamplerCalendarMonth
+func TestResamplerCalendarMonth(t *testing.T) {
+	r, err := NewResampler([]string{"1M"}, func(string) []string { return []string{"1m"} }, zap.NewNop())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// February 2025 has 28 days, fewer minutes than the nominal 30-day month
+	from := time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	var emitted []memorystore.Kline
+	for ts := from; ts.Before(to); ts = ts.Add(time.Minute) {
+		emitted = append(emitted, r.Update("BTCUSDT", minuteKline(ts.UnixMilli(), "1", "1", "1", "1"))...)
+	}
+
+	if len(emitted) != 1 || emitted[0].Start != from.UnixMilli() || emitted[0].End != to.UnixMilli()-1 {
+		t.Fatalf("expected one February candle, got %+v", emitted)
+	}
+	if stats := r.Stats(); stats.Incomplete != 0 {
+		t.Errorf("unexpected incomplete candles: %+v", stats)
+	}
+}
+
+// go test -v --run TestResamplerFirstPartialBucket
+func TestResamplerFirstPartialBucket(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	r, err := NewResampler([]string{"5m"}, func(string) []string { return []string{"1m"} }, zap.New(core))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Join the first bucket at its third minute, then miss a minute of the second
+	base := int64(1745573400000) // aligned to 5 minutes
+	for _, i := range []int64{2, 3, 4, 5, 6, 8, 9} {
+		r.Update("BTCUSDT", minuteKline(base+i*60000, "1", "1", "1", "1"))
+	}
+
+	discards := logs.FilterMessage("discarding incomplete derived candle").All()
+	if len(discards) != 2 || discards[0].Level != zapcore.DebugLevel || discards[1].Level != zapcore.WarnLevel {
+		t.Errorf("expected a debug then a warn discard, got %+v", discards)
+	}
+}
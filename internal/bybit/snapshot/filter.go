@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"wscollector/config"
+	"wscollector/pkg/bybit"
+)
+
+// Decision records whether an instrument made it into the symbol universe and why.
+type Decision struct {
+	Symbol   string
+	Included bool
+	Reason   string
+}
+
+// UniverseFilter selects the collected symbols from the instruments list.
+type UniverseFilter struct {
+	cfg     config.UniverseConfig
+	allow   map[string]struct{}
+	deny    map[string]struct{}
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewUniverseFilter compiles the filter from config. It fails on an invalid regex.
+func NewUniverseFilter(cfg config.UniverseConfig) (*UniverseFilter, error) {
+	f := &UniverseFilter{
+		cfg:   cfg,
+		allow: toSet(cfg.Allow),
+		deny:  toSet(cfg.Deny),
+	}
+
+	for _, p := range cfg.IncludePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", p, err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, p := range cfg.ExcludePatterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", p, err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+
+	return f, nil
+}
+
+// NeedsTickers reports whether the filter uses 24h turnover and therefore needs ticker data.
+func (f *UniverseFilter) NeedsTickers() bool {
+	return f.cfg.MinTurnover24h > 0 || f.cfg.MaxSymbols > 0 || f.cfg.DedupeBaseCoin
+}
+
+// Apply runs every instrument through the filter and returns one decision per instrument.
+// turnovers maps symbol to 24h turnover; it may be nil when NeedsTickers is false.
+func (f *UniverseFilter) Apply(instruments []bybit.Instrument, turnovers map[string]float64) []Decision {
+	decisions := make([]Decision, 0, len(instruments))
+	var candidates []bybit.Instrument
+
+	for _, inst := range instruments {
+		if reason, ok := f.check(inst, turnovers); !ok {
+			decisions = append(decisions, Decision{Symbol: inst.Symbol, Reason: reason})
+			continue
+		}
+		candidates = append(candidates, inst)
+	}
+
+	// Highest turnover first so dedup and max count keep the most liquid symbols
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return turnovers[candidates[i].Symbol] > turnovers[candidates[j].Symbol]
+	})
+
+	if f.cfg.DedupeBaseCoin {
+		candidates = f.dedupeBaseCoin(candidates, &decisions)
+	}
+
+	kept := 0
+	for _, inst := range candidates {
+		_, allowed := f.allow[inst.Symbol]
+		if f.cfg.MaxSymbols > 0 && kept >= f.cfg.MaxSymbols && !allowed {
+			decisions = append(decisions, Decision{Symbol: inst.Symbol, Reason: "max symbol count reached"})
+			continue
+		}
+
+		reason := "passed filters"
+		if allowed {
+			reason = "allow list"
+		}
+		decisions = append(decisions, Decision{Symbol: inst.Symbol, Included: true, Reason: reason})
+		kept++
+	}
+
+	return decisions
+}
+
+// check applies the per-instrument filters. It returns the exclusion reason and false on rejection.
+func (f *UniverseFilter) check(inst bybit.Instrument, turnovers map[string]float64) (string, bool) {
+	if _, denied := f.deny[inst.Symbol]; denied {
+		return "deny list", false
+	}
+	if _, allowed := f.allow[inst.Symbol]; allowed {
+		return "", true
+	}
+
+	if f.cfg.TradingOnly && inst.Status != "Trading" {
+		return "status " + inst.Status, false
+	}
+	if len(f.cfg.QuoteCoins) > 0 && !containsFold(f.cfg.QuoteCoins, inst.QuoteCoin) {
+		return "quote coin " + inst.QuoteCoin, false
+	}
+	if len(f.cfg.ContractTypes) > 0 && !containsFold(f.cfg.ContractTypes, inst.ContractType) {
+		return "contract type " + inst.ContractType, false
+	}
+	if len(f.include) > 0 && !matchesAny(f.include, inst.Symbol) {
+		return "no include pattern matched", false
+	}
+	if matchesAny(f.exclude, inst.Symbol) {
+		return "exclude pattern matched", false
+	}
+	if f.cfg.MinTurnover24h > 0 && turnovers[inst.Symbol] < f.cfg.MinTurnover24h {
+		return "24h turnover " + strconv.FormatFloat(turnovers[inst.Symbol], 'f', 0, 64) + " below minimum", false
+	}
+
+	return "", true
+}
+
+// dedupeBaseCoin keeps one instrument per base coin. Perpetuals win over dated futures,
+// then the higher-turnover symbol (candidates are already sorted by turnover).
+func (f *UniverseFilter) dedupeBaseCoin(candidates []bybit.Instrument, decisions *[]Decision) []bybit.Instrument {
+	best := make(map[string]bybit.Instrument)
+	for _, inst := range candidates {
+		cur, ok := best[inst.BaseCoin]
+		if !ok || (!isPerpetual(cur) && isPerpetual(inst)) {
+			best[inst.BaseCoin] = inst
+		}
+	}
+
+	out := candidates[:0:0]
+	for _, inst := range candidates {
+		_, allowed := f.allow[inst.Symbol]
+		if best[inst.BaseCoin].Symbol != inst.Symbol && !allowed {
+			*decisions = append(*decisions, Decision{
+				Symbol: inst.Symbol,
+				Reason: "duplicate base coin " + inst.BaseCoin + " (kept " + best[inst.BaseCoin].Symbol + ")",
+			})
+			continue
+		}
+		out = append(out, inst)
+	}
+	return out
+}
+
+// ParseTurnovers maps each ticker's symbol to its 24h turnover, skipping unparsable values.
+func ParseTurnovers(tickers []bybit.Ticker) map[string]float64 {
+	out := make(map[string]float64, len(tickers))
+	for _, t := range tickers {
+		v, err := strconv.ParseFloat(t.Turnover24h, 64)
+		if err != nil {
+			continue
+		}
+		out[t.Symbol] = v
+	}
+	return out
+}
+
+func isPerpetual(inst bybit.Instrument) bool {
+	return strings.HasSuffix(inst.ContractType, "Perpetual")
+}
+
+func toSet(items []string) map[string]struct{} {
+	out := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		out[strings.ToUpper(item)] = struct{}{}
+	}
+	return out
+}
+
+func containsFold(items []string, s string) bool {
+	for _, item := range items {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package snapshot
+
+import (
+	"testing"
+
+	"wscollector/config"
+	"wscollector/pkg/bybit"
+)
+
+// go test -v --run TestUniverseFilterApply
+func TestUniverseFilterApply(t *testing.T) {
+	filter, err := NewUniverseFilter(config.UniverseConfig{
+		QuoteCoins:      []string{"USDT"},
+		TradingOnly:     true,
+		Deny:            []string{"LUNAUSDT"},
+		ExcludePatterns: []string{"^1000"},
+		MinTurnover24h:  1000,
+		DedupeBaseCoin:  true,
+		MaxSymbols:      2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	instruments := []bybit.Instrument{
+		{Symbol: "BTC-27JUN25", BaseCoin: "BTC", QuoteCoin: "USDT", ContractType: "LinearFutures", Status: "Trading"},
+		{Symbol: "BTCUSDT", BaseCoin: "BTC", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "Trading"},
+		{Symbol: "ETHUSDT", BaseCoin: "ETH", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "Trading"},
+		{Symbol: "SOLUSDT", BaseCoin: "SOL", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "Trading"},
+		{Symbol: "BTCPERP", BaseCoin: "BTC", QuoteCoin: "USDC", ContractType: "LinearPerpetual", Status: "Trading"},
+		{Symbol: "LUNAUSDT", BaseCoin: "LUNA", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "Trading"},
+		{Symbol: "1000PEPEUSDT", BaseCoin: "1000PEPE", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "Trading"},
+		{Symbol: "NEWUSDT", BaseCoin: "NEW", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "PreLaunch"},
+		{Symbol: "DUSTUSDT", BaseCoin: "DUST", QuoteCoin: "USDT", ContractType: "LinearPerpetual", Status: "Trading"},
+	}
+	turnovers := map[string]float64{
+		"BTC-27JUN25": 9e9, // more liquid than the perpetual, but perpetual must win dedup
+		"BTCUSDT":     5e9,
+		"ETHUSDT":     3e9,
+		"SOLUSDT":     1e9,
+		"DUSTUSDT":    10,
+	}
+
+	var included []string
+	reasons := map[string]string{}
+	for _, d := range filter.Apply(instruments, turnovers) {
+		if d.Included {
+			included = append(included, d.Symbol)
+		}
+		reasons[d.Symbol] = d.Reason
+	}
+
+	if len(included) != 2 || included[0] != "BTCUSDT" || included[1] != "ETHUSDT" {
+		t.Fatalf("unexpected universe: %v (reasons: %v)", included, reasons)
+	}
+	if reasons["SOLUSDT"] != "max symbol count reached" {
+		t.Errorf("unexpected reason for SOLUSDT: %q", reasons["SOLUSDT"])
+	}
+	if reasons["LUNAUSDT"] != "deny list" {
+		t.Errorf("unexpected reason for LUNAUSDT: %q", reasons["LUNAUSDT"])
+	}
+	if len(reasons) != len(instruments) {
+		t.Errorf("expected a decision for every instrument, got %d", len(reasons))
+	}
+}
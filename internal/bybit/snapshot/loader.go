@@ -15,21 +15,50 @@ type SymbolLoader struct {
 	Logger     *zap.Logger
 }
 
-// LoadSymbols fetches USDT-margined altcoin trading pairs from Bybit
-// and streams them into the provided channel.
-// The function applies a 10-second timeout to the REST request.
+// LoadSymbols fetches linear instruments from Bybit, applies the configured universe filter,
+// and streams the selected symbols into the provided channel.
+// The function applies the configured REST timeout to the requests.
 func (l *SymbolLoader) LoadSymbols(ch chan<- string) error {
 	defer close(ch) // Ensure downstream consumers can exit cleanly
 
 	ctx, cancel := context.WithTimeout(context.Background(), l.Cfg.Bybit.REST.Timeout)
 	defer cancel()
 
-	symbols, err := l.RestClient.GetUSDTAltcoinSymbols(ctx)
+	filter, err := NewUniverseFilter(l.Cfg.Bybit.Universe)
 	if err != nil {
-		l.Logger.Error("failed to load USDT altcoin symbols", zap.Error(err))
+		l.Logger.Error("invalid universe filter", zap.Error(err))
 		return err
 	}
-	l.Logger.Info("loaded symbols", zap.Int("count", len(symbols)))
+
+	instruments, err := l.RestClient.GetInstruments(ctx, "linear")
+	if err != nil {
+		l.Logger.Error("failed to load instruments", zap.Error(err))
+		return err
+	}
+
+	var turnovers map[string]float64
+	if filter.NeedsTickers() {
+		tickers, err := l.RestClient.GetTickers(ctx, "linear")
+		if err != nil {
+			l.Logger.Error("failed to load tickers", zap.Error(err))
+			return err
+		}
+		turnovers = ParseTurnovers(tickers)
+	}
+
+	var symbols []string
+	for _, d := range filter.Apply(instruments, turnovers) {
+		if d.Included {
+			l.Logger.Debug("symbol included", zap.String("symbol", d.Symbol), zap.String("reason", d.Reason))
+			symbols = append(symbols, d.Symbol)
+		} else {
+			l.Logger.Debug("symbol excluded", zap.String("symbol", d.Symbol), zap.String("reason", d.Reason))
+		}
+	}
+	l.Logger.Info("loaded symbols",
+		zap.Int("instruments", len(instruments)),
+		zap.Int("count", len(symbols)),
+	)
 
 	for _, symbol := range symbols {
 		select {
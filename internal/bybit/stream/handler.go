@@ -1,20 +1,24 @@
 package stream
 
 import (
-	"context"
 	"encoding/json"
 	"strings"
 
 	"wscollector/internal/bybit/memorystore"
-	"wscollector/pkg/storage/postgres"
+	"wscollector/internal/bybit/resample"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/storage/sink"
 
 	"go.uber.org/zap"
 )
 
 // MakeMessageHandler returns a function that handles incoming WebSocket messages
 // by parsing kline data and storing it in memory.
-func MakeMessageHandler(logger *zap.Logger, store *memorystore.MemoryKlineStore,
-	postgresClient *postgres.PostgresClient) func(msg []byte) {
+// If resampler is non-nil, confirmed 1m candles also produce derived higher-timeframe candles.
+// If live is non-nil, forming candles are tracked instead of being dropped.
+// Confirmed candles are written to klineSink, e.g. a fan-out over memory and Postgres.
+func MakeMessageHandler(logger *zap.Logger, klineSink sink.KlineSink,
+	resampler *resample.Resampler, live *LiveTracker) func(msg []byte) {
 	return func(msg []byte) {
 		// Step 1: Extract topic string for early filtering
 		var meta struct {
@@ -36,17 +40,25 @@ func MakeMessageHandler(logger *zap.Logger, store *memorystore.MemoryKlineStore,
 		}
 		symbol := extractSymbolFromTopic(parsed.Topic) // e.g., "kline.1.BTCUSDT" → "BTCUSDT"
 
+		// Route by the topic's interval so every subscribed timeframe is stored under its DB value
+		intervalMeta, err := bybit.ParseKlineInterval(extractIntervalFromTopic(parsed.Topic))
+		if err != nil {
+			logger.Warn("unknown kline interval in topic", zap.String("topic", parsed.Topic), zap.Error(err))
+			return
+		}
+
 		// Step 3: Store parsed kline data
 		for _, d := range parsed.Data {
-			// Optional: store only confirmed klines
-			if !d.Confirm {
+			// Forming candles are only kept by the live tracker
+			if !d.Confirm && live == nil {
 				continue
 			}
 
 			kline := memorystore.Kline{
 				Start:     d.Start,
 				End:       d.End,
-				Interval:  d.Interval,
+				Interval:  intervalMeta.DBValue,
+				PriceType: string(bybit.PriceTypeLast),
 				Open:      d.Open,
 				Close:     d.Close,
 				High:      d.High,
@@ -56,30 +68,51 @@ func MakeMessageHandler(logger *zap.Logger, store *memorystore.MemoryKlineStore,
 				Confirm:   d.Confirm,
 				Timestamp: d.Timestamp,
 			}
-			// Insert Kline data into Memory
-			store.Add(memorystore.KlineMemory{
-				Symbol: symbol,
-				Kline:  kline,
-			})
+			if live != nil {
+				live.Update(logger, symbol, kline)
+			}
+			if !kline.Confirm {
+				continue
+			}
+
+			storeKline(logger, klineSink, symbol, kline)
 
-			ctx := context.Background()
-			klineRecord, err := postgres.ToKlineRecord(symbol, kline)
-			if err != nil {
-				logger.Warn("failed to convert kline data to kline record", zap.Error(err))
+			if resampler == nil {
+				continue
 			}
-			// Insert Kline record into Postgres
-			if err := postgresClient.InsertKline(ctx, klineRecord); err != nil {
-				logger.Warn("failed to insert kline record", zap.Error(err))
+			for _, derived := range resampler.Update(symbol, kline) {
+				storeKline(logger, klineSink, symbol, derived)
 			}
 		}
 	}
 }
 
+// storeKline writes a confirmed kline to the sink. A failing backend is logged;
+// the fan-out still delivers the kline to the others.
+func storeKline(logger *zap.Logger, klineSink sink.KlineSink, symbol string, kline memorystore.Kline) {
+	err := klineSink.WriteKline(memorystore.KlineMemory{
+		Symbol: symbol,
+		Kline:  kline,
+	})
+	if err != nil {
+		logger.Warn("failed to store kline", zap.String("symbol", symbol), zap.Error(err))
+	}
+}
+
 // isKlineTopic returns true if the topic string indicates a kline stream.
 func isKlineTopic(topic string) bool {
 	return strings.HasPrefix(topic, "kline.")
 }
 
+// extractIntervalFromTopic parses the interval from a topic like "kline.1.BTCUSDT".
+func extractIntervalFromTopic(topic string) string {
+	parts := strings.Split(topic, ".")
+	if len(parts) == 3 {
+		return parts[1]
+	}
+	return ""
+}
+
 // extractSymbolFromTopic parses the symbol from a topic like "kline.1.BTCUSDT".
 func extractSymbolFromTopic(topic string) string {
 	parts := strings.Split(topic, ".")
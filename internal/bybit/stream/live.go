@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/storage/postgres"
+
+	"go.uber.org/zap"
+)
+
+// LiveTracker records forming (unconfirmed) candles in memory and, optionally,
+// upserts them to Postgres at most once per PersistInterval per symbol/interval.
+// Upserts run on a background worker started by Start, so a slow database never
+// holds up the WebSocket reader; candles queued while it is busy are coalesced,
+// keeping only the latest per symbol/interval.
+type LiveTracker struct {
+	Store           *memorystore.MemoryLiveStore
+	Postgres        *postgres.PostgresClient // nil disables persistence
+	PersistInterval time.Duration
+
+	mu          sync.Mutex
+	lastPersist map[memorystore.LiveKey]time.Time
+	pending     map[memorystore.LiveKey]memorystore.Kline
+	wake        chan struct{}
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// Update applies a forming or confirmed candle to the live store and queues
+// forming candles for persistence when it is enabled and the throttle allows it.
+func (t *LiveTracker) Update(logger *zap.Logger, symbol string, kline memorystore.Kline) {
+	changed := t.Store.Update(memorystore.KlineMemory{Symbol: symbol, Kline: kline})
+	if !changed || kline.Confirm || t.Postgres == nil || !t.shouldPersist(symbol, kline.Interval) {
+		return
+	}
+
+	t.mu.Lock()
+	if t.pending == nil {
+		t.pending = make(map[memorystore.LiveKey]memorystore.Kline)
+	}
+	t.pending[memorystore.LiveKey{Symbol: symbol, Interval: kline.Interval}] = kline
+	wake := t.wake
+	t.mu.Unlock()
+
+	if wake != nil {
+		select {
+		case wake <- struct{}{}:
+		default: // the worker is already due to run
+		}
+	}
+}
+
+// Start runs the persistence worker. It does nothing without Postgres.
+func (t *LiveTracker) Start(logger *zap.Logger) {
+	if t.Postgres == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.wake = make(chan struct{}, 1)
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	t.mu.Unlock()
+
+	go func() {
+		defer close(t.done)
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-t.wake:
+				t.persist(logger)
+			}
+		}
+	}()
+}
+
+// Stop ends the persistence worker after its current upserts. Forming candles still
+// queued are dropped; the confirmed candles that replace them are written elsewhere.
+func (t *LiveTracker) Stop() {
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+}
+
+// persist upserts the queued forming candles.
+func (t *LiveTracker) persist(logger *zap.Logger) {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	for key, kline := range pending {
+		record, err := postgres.ToKlineRecord(key.Symbol, kline)
+		if err != nil {
+			logger.Warn("failed to convert live kline to kline record", zap.Error(err))
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err = t.Postgres.UpsertLiveKline(ctx, record)
+		cancel()
+		if err != nil {
+			logger.Warn("failed to upsert live kline", zap.String("symbol", key.Symbol), zap.Error(err))
+		}
+	}
+}
+
+func (t *LiveTracker) shouldPersist(symbol, interval string) bool {
+	key := memorystore.LiveKey{Symbol: symbol, Interval: interval}
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.lastPersist == nil {
+		t.lastPersist = make(map[memorystore.LiveKey]time.Time)
+	}
+	if now.Sub(t.lastPersist[key]) < t.PersistInterval {
+		return false
+	}
+	t.lastPersist[key] = now
+	return true
+}
@@ -1,11 +1,16 @@
 package bybit
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
 
 // KlineInterval is the interval type used for API requests
 type KlineInterval string
 
-// KlineIntervalMeta holds API value and DB value for a Kline interval
+// KlineIntervalMeta holds API value and DB value for a Kline interval.
+// Minutes is nominal for weekly and monthly intervals; see interval.go for candle boundaries.
 type KlineIntervalMeta struct {
 	APIValue string
 	DBValue  string
@@ -42,7 +47,12 @@ var validKlineIntervals = map[KlineInterval]KlineIntervalMeta{
 	Interval720Min:  {APIValue: "720", DBValue: "12h", Minutes: 720},
 	IntervalDaily:   {APIValue: "D", DBValue: "1d", Minutes: 1440},  // 24*60
 	IntervalWeekly:  {APIValue: "W", DBValue: "1w", Minutes: 10080}, // 7*24*60
-	IntervalMonthly: {APIValue: "M", DBValue: "1M", Minutes: 43200}, // 30*24*60 // TODO: FIX - 30 days assumption, handle actual month duration
+	IntervalMonthly: {APIValue: "M", DBValue: "1M", Minutes: 43200}, // 30*24*60 nominal; use Align/Next/End for calendar months
+}
+
+// IsNative reports whether Bybit publishes this interval (derived-only intervals have no API value)
+func (m KlineIntervalMeta) IsNative() bool {
+	return m.APIValue != ""
 }
 
 // IsValid checks if the KlineInterval is a valid predefined interval
@@ -60,3 +70,114 @@ func ParseKlineInterval(s string) (KlineIntervalMeta, error) {
 	}
 	return meta, nil
 }
+
+// ParseDBInterval parses a DB interval value (e.g., "5m", "1h", "1d") into a KlineIntervalMeta.
+// Bybit-native intervals resolve to the table above; any other whole number of minutes,
+// hours or days up to one day (e.g., "2m", "10m") resolves to a derived-only meta.
+func ParseDBInterval(s string) (KlineIntervalMeta, error) {
+	for _, meta := range validKlineIntervals {
+		if meta.DBValue == s {
+			return meta, nil
+		}
+	}
+
+	if len(s) < 2 {
+		return KlineIntervalMeta{}, fmt.Errorf("invalid DB interval: %s", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n <= 0 {
+		return KlineIntervalMeta{}, fmt.Errorf("invalid DB interval: %s", s)
+	}
+
+	var minutes int
+	switch s[len(s)-1] {
+	case 'm':
+		minutes = n
+	case 'h':
+		minutes = n * 60
+	case 'd':
+		minutes = n * 1440
+	default:
+		return KlineIntervalMeta{}, fmt.Errorf("invalid DB interval: %s", s)
+	}
+	if minutes > 1440 {
+		return KlineIntervalMeta{}, fmt.Errorf("derived interval longer than a day: %s", s)
+	}
+
+	return KlineIntervalMeta{DBValue: s, Minutes: minutes}, nil
+}
+
+// KlinePriceType selects which price series a kline is built from
+type KlinePriceType string
+
+const (
+	PriceTypeLast         KlinePriceType = "last"
+	PriceTypeMark         KlinePriceType = "mark"
+	PriceTypeIndex        KlinePriceType = "index"
+	PriceTypePremiumIndex KlinePriceType = "premium_index"
+)
+
+// klinePriceTypePaths maps KlinePriceType to its REST endpoint path
+var klinePriceTypePaths = map[KlinePriceType]string{
+	PriceTypeLast:         "/v5/market/kline",
+	PriceTypeMark:         "/v5/market/mark-price-kline",
+	PriceTypeIndex:        "/v5/market/index-price-kline",
+	PriceTypePremiumIndex: "/v5/market/premium-index-price-kline",
+}
+
+// IsValid checks if the KlinePriceType is a valid predefined price type
+func (p KlinePriceType) IsValid() bool {
+	_, ok := klinePriceTypePaths[p]
+	return ok
+}
+
+// HasStream reports whether Bybit publishes this price type over the public WebSocket.
+// Only last-traded klines are streamed; the others must be polled via REST.
+func (p KlinePriceType) HasStream() bool {
+	return p == PriceTypeLast
+}
+
+// ParseKlinePriceType parses a string into a valid KlinePriceType
+func ParseKlinePriceType(s string) (KlinePriceType, error) {
+	priceType := KlinePriceType(s)
+	if !priceType.IsValid() {
+		return "", fmt.Errorf("invalid KlinePriceType: %s", s)
+	}
+	return priceType, nil
+}
+
+// AccountRatioPeriod is the data recording period for the long/short account ratio
+type AccountRatioPeriod string
+
+const (
+	AccountRatioPeriod5Min  AccountRatioPeriod = "5min"
+	AccountRatioPeriod15Min AccountRatioPeriod = "15min"
+	AccountRatioPeriod30Min AccountRatioPeriod = "30min"
+	AccountRatioPeriod1H    AccountRatioPeriod = "1h"
+	AccountRatioPeriod4H    AccountRatioPeriod = "4h"
+	AccountRatioPeriod1D    AccountRatioPeriod = "1d"
+)
+
+// validAccountRatioPeriods maps AccountRatioPeriod to its duration
+var validAccountRatioPeriods = map[AccountRatioPeriod]time.Duration{
+	AccountRatioPeriod5Min:  5 * time.Minute,
+	AccountRatioPeriod15Min: 15 * time.Minute,
+	AccountRatioPeriod30Min: 30 * time.Minute,
+	AccountRatioPeriod1H:    time.Hour,
+	AccountRatioPeriod4H:    4 * time.Hour,
+	AccountRatioPeriod1D:    24 * time.Hour,
+}
+
+// Duration returns the length of the period, or zero if it is not a valid period
+func (p AccountRatioPeriod) Duration() time.Duration {
+	return validAccountRatioPeriods[p]
+}
+
+// ParseAccountRatioPeriod parses a string into a valid AccountRatioPeriod
+func ParseAccountRatioPeriod(s string) (AccountRatioPeriod, error) {
+	period := AccountRatioPeriod(s)
+	if _, ok := validAccountRatioPeriods[period]; !ok {
+		return "", fmt.Errorf("invalid AccountRatioPeriod: %s", s)
+	}
+	return period, nil
+}
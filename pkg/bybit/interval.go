@@ -0,0 +1,86 @@
+package bybit
+
+import "time"
+
+// Interval arithmetic in UTC. Intervals up to one day are fixed multiples of a minute
+// aligned to the Unix epoch. Weekly candles start on Monday 00:00 UTC and monthly
+// candles on the first day of the calendar month, matching Bybit's kline boundaries.
+
+// Align returns the start of the candle that contains t.
+func (m KlineIntervalMeta) Align(t time.Time) time.Time {
+	t = t.UTC()
+
+	switch m.DBValue {
+	case "1w":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	case "1M":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	size := m.size().Milliseconds()
+	ms := t.UnixMilli()
+	rem := ms % size
+	if rem < 0 {
+		rem += size
+	}
+	return time.UnixMilli(ms - rem).UTC()
+}
+
+// Next returns the start of the candle following the one that starts at start.
+func (m KlineIntervalMeta) Next(start time.Time) time.Time {
+	return m.Add(start, 1)
+}
+
+// Prev returns the start of the candle preceding the one that starts at start.
+func (m KlineIntervalMeta) Prev(start time.Time) time.Time {
+	return m.Add(start, -1)
+}
+
+// Add returns the start of the candle n candles after (or before, if n < 0) the one containing t.
+func (m KlineIntervalMeta) Add(t time.Time, n int) time.Time {
+	start := m.Align(t)
+
+	switch m.DBValue {
+	case "1w":
+		return start.AddDate(0, 0, 7*n)
+	case "1M":
+		return start.AddDate(0, n, 0)
+	}
+	return start.Add(time.Duration(n) * m.size())
+}
+
+// End returns the last millisecond of the candle that starts at start,
+// matching Bybit's inclusive kline end time.
+func (m KlineIntervalMeta) End(start time.Time) time.Time {
+	return m.Next(start).Add(-time.Millisecond)
+}
+
+// Count returns the number of candle starts in [from, to).
+func (m KlineIntervalMeta) Count(from, to time.Time) int {
+	first := m.Align(from)
+	if first.Before(from) {
+		first = m.Next(first)
+	}
+	if !to.After(first) {
+		return 0
+	}
+
+	if m.DBValue == "1M" {
+		last := m.Align(to.Add(-time.Millisecond))
+		months := (last.Year()-first.Year())*12 + int(last.Month()-first.Month())
+		return months + 1
+	}
+
+	size := m.size()
+	if m.DBValue == "1w" {
+		size = 7 * 24 * time.Hour
+	}
+	return int((to.Sub(first)-time.Millisecond)/size) + 1
+}
+
+// size is the fixed length of intervals up to one day.
+func (m KlineIntervalMeta) size() time.Duration {
+	return time.Duration(m.Minutes) * time.Minute
+}
@@ -0,0 +1,59 @@
+package bybit
+
+import (
+	"testing"
+	"time"
+)
+
+// go test -v --run TestIntervalArithmetic
+func TestIntervalArithmetic(t *testing.T) {
+	ts := time.Date(2024, time.February, 14, 13, 37, 12, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		interval string
+		align    time.Time
+		next     time.Time
+	}{
+		{"15", time.Date(2024, 2, 14, 13, 30, 0, 0, time.UTC), time.Date(2024, 2, 14, 13, 45, 0, 0, time.UTC)},
+		{"240", time.Date(2024, 2, 14, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 14, 16, 0, 0, 0, time.UTC)},
+		{"D", time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)},
+		{"W", time.Date(2024, 2, 12, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 19, 0, 0, 0, 0, time.UTC)},
+		{"M", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		meta, err := ParseKlineInterval(tt.interval)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := meta.Align(ts); !got.Equal(tt.align) {
+			t.Errorf("%s: Align = %v, want %v", tt.interval, got, tt.align)
+		}
+		if got := meta.Next(tt.align); !got.Equal(tt.next) {
+			t.Errorf("%s: Next = %v, want %v", tt.interval, got, tt.next)
+		}
+		if got := meta.End(tt.align); !got.Equal(tt.next.Add(-time.Millisecond)) {
+			t.Errorf("%s: End = %v, want %v", tt.interval, got, tt.next.Add(-time.Millisecond))
+		}
+	}
+
+	// February 2024 has 29 days
+	monthly, _ := ParseKlineInterval("M")
+	feb := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	if got := monthly.End(feb); !got.Equal(time.Date(2024, 2, 29, 23, 59, 59, 999000000, time.UTC)) {
+		t.Errorf("monthly End = %v", got)
+	}
+	if got := monthly.Count(feb, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)); got != 12 {
+		t.Errorf("monthly Count = %d, want 12", got)
+	}
+
+	weekly, _ := ParseKlineInterval("W")
+	if got := weekly.Count(ts, ts.AddDate(0, 0, 14)); got != 2 {
+		t.Errorf("weekly Count = %d, want 2", got)
+	}
+
+	minute, _ := ParseKlineInterval("1")
+	if got := minute.Count(ts, ts.Add(time.Hour)); got != 60 {
+		t.Errorf("minute Count = %d, want 60", got)
+	}
+}
@@ -5,57 +5,63 @@ import (
 	"time"
 
 	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
 )
 
 // ParseKlineList converts Bybit REST API kline data to []Kline.
+// Prices are kept as exact decimals in the text Bybit sent.
 // It safely skips invalid rows and sets default values for fields not included in REST (e.g., Confirm).
+// Mark, index and premium-index rows carry only OHLC, so their volume and turnover default to zero.
 func ParseKlineList(meta KlineIntervalMeta, raw [][]string) ([]memorystore.Kline, error) {
 	var out []memorystore.Kline
 
 	for _, row := range raw {
-		if len(row) < 7 {
+		if len(row) < 5 {
 			continue // skip incomplete row
 		}
+		if len(row) < 7 {
+			row = append(row[:5:5], "0", "0") // price-only row (mark/index/premium-index)
+		}
 
 		start, err := strconv.ParseInt(row[0], 10, 64)
 		if err != nil {
 			continue
 		}
-		open, err := strconv.ParseFloat(row[1], 64)
+		open, err := decimal.Parse(row[1])
 		if err != nil {
 			continue
 		}
-		high, err := strconv.ParseFloat(row[2], 64)
+		high, err := decimal.Parse(row[2])
 		if err != nil {
 			continue
 		}
-		low, err := strconv.ParseFloat(row[3], 64)
+		low, err := decimal.Parse(row[3])
 		if err != nil {
 			continue
 		}
-		closeVal, err := strconv.ParseFloat(row[4], 64)
+		closeVal, err := decimal.Parse(row[4])
 		if err != nil {
 			continue
 		}
-		volume, err := strconv.ParseFloat(row[5], 64)
+		volume, err := decimal.Parse(row[5])
 		if err != nil {
 			continue
 		}
-		turnover, err := strconv.ParseFloat(row[6], 64)
+		turnover, err := decimal.Parse(row[6])
 		if err != nil {
 			continue
 		}
 
 		out = append(out, memorystore.Kline{
 			Start:     start,
-			End:       time.UnixMilli(start).Add(time.Duration(meta.Minutes)*time.Minute - time.Millisecond).UnixMilli(),
+			End:       meta.End(time.UnixMilli(start)).UnixMilli(),
 			Interval:  meta.DBValue,
-			Open:      strconv.FormatFloat(open, 'f', -1, 64),
-			High:      strconv.FormatFloat(high, 'f', -1, 64),
-			Low:       strconv.FormatFloat(low, 'f', -1, 64),
-			Close:     strconv.FormatFloat(closeVal, 'f', -1, 64),
-			Volume:    strconv.FormatFloat(volume, 'f', -1, 64),
-			Turnover:  strconv.FormatFloat(turnover, 'f', -1, 64),
+			Open:      open,
+			High:      high,
+			Low:       low,
+			Close:     closeVal,
+			Volume:    volume,
+			Turnover:  turnover,
 			Confirm:   true,
 			Timestamp: time.Now().UnixMilli(), // Time of ingestion // or use Start.Add(...) as approximation
 		})
@@ -0,0 +1,31 @@
+package bybit
+
+import "testing"
+
+// go test -v --run TestParseKlineList_PriceOnlyRows
+func TestParseKlineList_PriceOnlyRows(t *testing.T) {
+	meta, err := ParseKlineInterval("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	raw := [][]string{
+		{"1745573520000", "0.1", "0.3", "0.05", "0.20", "100", "20"}, // last-traded row
+		{"1745573580000", "0.2", "0.4", "0.1", "0.3"},                // mark/index row
+		{"1745573640000", "0.2"},                                     // incomplete row
+	}
+
+	klines, err := ParseKlineList(meta, raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(klines) != 2 {
+		t.Fatalf("expected 2 klines, got %d", len(klines))
+	}
+	if klines[1].Close.String() != "0.3" || klines[1].Volume.String() != "0" || klines[1].Turnover.String() != "0" {
+		t.Errorf("unexpected price-only kline: %+v", klines[1])
+	}
+	if klines[0].Close.String() != "0.20" {
+		t.Errorf("expected exact wire text 0.20, got %s", klines[0].Close)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	"wscollector/internal/bybit/memorystore"
@@ -29,63 +30,120 @@ func (c *RESTClient) HTTPClient() *http.Client {
 
 // GetUSDTAltcoinSymbols fetches linear symbols with quoteCoin = USDT (altcoins).
 func (c *RESTClient) GetUSDTAltcoinSymbols(ctx context.Context) ([]string, error) {
-	endpoint := c.baseURL + "/v5/market/instruments-info?category=linear&limit=1000"
+	instruments, err := c.GetInstruments(ctx, "linear")
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect USDT-based altcoins
+	seen := map[string]bool{}
+	var baseCoins []string
+	for _, symbol := range instruments {
+		if symbol.QuoteCoin == "USDT" && !seen[symbol.BaseCoin] {
+			// baseCoins = append(baseCoins, symbol.BaseCoin)
+			baseCoins = append(baseCoins, symbol.Symbol)
+			seen[symbol.BaseCoin] = true
+		}
+	}
+
+	return baseCoins, nil
+}
+
+// GetInstruments fetches every instrument of the given category, following pagination cursors.
+func (c *RESTClient) GetInstruments(ctx context.Context, category string) ([]Instrument, error) {
+	var instruments []Instrument
+	cursor := ""
+
+	for {
+		endpoint := fmt.Sprintf("%s/v5/market/instruments-info?category=%s&limit=1000", c.baseURL, category)
+		if cursor != "" {
+			endpoint += "&cursor=" + url.QueryEscape(cursor)
+		}
 
+		var result InstrumentListResponse
+		if err := c.getResult(ctx, endpoint, &result); err != nil {
+			return nil, err
+		}
+		instruments = append(instruments, result.List...)
+
+		if result.NextPageCursor == "" || len(result.List) == 0 {
+			return instruments, nil
+		}
+		cursor = result.NextPageCursor
+	}
+}
+
+// GetTickers fetches the 24h ticker snapshot of every symbol in the given category.
+func (c *RESTClient) GetTickers(ctx context.Context, category string) ([]Ticker, error) {
+	endpoint := fmt.Sprintf("%s/v5/market/tickers?category=%s", c.baseURL, category)
+
+	var result TickerListResponse
+	if err := c.getResult(ctx, endpoint, &result); err != nil {
+		return nil, err
+	}
+	return result.List, nil
+}
+
+// getResult performs a GET request and decodes the result field of the response envelope into out.
+func (c *RESTClient) getResult(ctx context.Context, endpoint string, out interface{}) error {
 	// Construct the GET request with context for timeout/cancel support
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+		return fmt.Errorf("creating request: %w", err)
 	}
 
 	// Execute the HTTP request
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("making request: %w", err)
+		return fmt.Errorf("making request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Check HTTP status code
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("bybit error: %s", body)
+		return fmt.Errorf("bybit error: %s", body)
 	}
 
 	var rawResp BybitResponse
 	if err := json.NewDecoder(resp.Body).Decode(&rawResp); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
+		return fmt.Errorf("decode response: %w", err)
 	}
-
-	// Decode result into InstrumentListResponse
-	var result InstrumentListResponse
-	if err := json.Unmarshal(rawResp.Result, &result); err != nil {
-		return nil, fmt.Errorf("decode result: %w", err)
+	if rawResp.RetCode != 0 {
+		return fmt.Errorf("bybit error: code=%d msg=%s", rawResp.RetCode, rawResp.RetMsg)
 	}
 
-	// Collect USDT-based altcoins
-	seen := map[string]bool{}
-	var baseCoins []string
-	for _, symbol := range result.List {
-		if symbol.QuoteCoin == "USDT" && !seen[symbol.BaseCoin] {
-			// baseCoins = append(baseCoins, symbol.BaseCoin)
-			baseCoins = append(baseCoins, symbol.Symbol)
-			seen[symbol.BaseCoin] = true
-		}
+	if err := json.Unmarshal(rawResp.Result, out); err != nil {
+		return fmt.Errorf("decode result: %w", err)
 	}
-
-	return baseCoins, nil
+	return nil
 }
 
+// GetKlines fetches last-traded klines for a symbol in the given time range.
 func (c *RESTClient) GetKlines(ctx context.Context, category, symbol, interval string,
 	start, end time.Time) ([]memorystore.Kline, error) {
+	return c.GetPriceKlines(ctx, category, symbol, interval, PriceTypeLast, start, end)
+}
+
+// GetPriceKlines fetches klines of the given price type (last, mark, index or premium index)
+// for a symbol in the given time range.
+func (c *RESTClient) GetPriceKlines(ctx context.Context, category, symbol, interval string,
+	priceType KlinePriceType, start, end time.Time) ([]memorystore.Kline, error) {
 	// Parse the interval string into a KlineIntervalMeta type
 	klineMeta, err := ParseKlineInterval(interval)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse interval: %w", err)
 	}
 
+	path, ok := klinePriceTypePaths[priceType]
+	if !ok {
+		return nil, fmt.Errorf("invalid KlinePriceType: %s", priceType)
+	}
+
 	endpoint := fmt.Sprintf(
-		"%s/v5/market/kline?category=%s&symbol=%s&interval=%s&start=%d&end=%d&limit=1000",
+		"%s%s?category=%s&symbol=%s&interval=%s&start=%d&end=%d&limit=1000",
 		c.baseURL,
+		path,
 		category,
 		symbol,
 		klineMeta.APIValue,
@@ -93,40 +151,54 @@ func (c *RESTClient) GetKlines(ctx context.Context, category, symbol, interval s
 		end.UnixMilli(),
 	)
 
-	// Construct the GET request with context for timeout/cancel support
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Execute the HTTP request
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("http request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Check HTTP status code
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("bybit error: %s", body)
-	}
-
-	var rawResp BybitResponse
-	if err := json.NewDecoder(resp.Body).Decode(&rawResp); err != nil {
-		return nil, fmt.Errorf("decode response: %w", err)
-	}
-
-	// Decode result into KlinesResponse
 	var result KlinesResponse
-	if err := json.Unmarshal(rawResp.Result, &result); err != nil {
-		return nil, fmt.Errorf("decode result: %w", err)
+	if err := c.getResult(ctx, endpoint, &result); err != nil {
+		return nil, err
 	}
 
 	klines, err := ParseKlineList(klineMeta, result.List)
 	if err != nil {
 		return nil, fmt.Errorf("parse result: %w", err)
 	}
+	for i := range klines {
+		klines[i].PriceType = string(priceType)
+	}
 
 	return klines, nil
 }
+
+// GetAccountRatio fetches the long/short account ratio for a symbol in the given time range.
+// Bybit returns at most 500 samples per request, newest first, so it follows the pagination
+// cursor until the range is covered.
+func (c *RESTClient) GetAccountRatio(ctx context.Context, category, symbol string,
+	period AccountRatioPeriod, start, end time.Time) ([]AccountRatio, error) {
+	var samples []AccountRatio
+	cursor := ""
+
+	for {
+		endpoint := fmt.Sprintf(
+			"%s/v5/market/account-ratio?category=%s&symbol=%s&period=%s&startTime=%d&endTime=%d&limit=500",
+			c.baseURL,
+			category,
+			symbol,
+			period,
+			start.UnixMilli(),
+			end.UnixMilli(),
+		)
+		if cursor != "" {
+			endpoint += "&cursor=" + url.QueryEscape(cursor)
+		}
+
+		var result AccountRatioResponse
+		if err := c.getResult(ctx, endpoint, &result); err != nil {
+			return nil, err
+		}
+		samples = append(samples, result.List...)
+
+		if result.NextPageCursor == "" || len(result.List) == 0 ||
+			result.List[len(result.List)-1].Timestamp <= start.UnixMilli() {
+			return samples, nil
+		}
+		cursor = result.NextPageCursor
+	}
+}
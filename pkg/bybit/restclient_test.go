@@ -2,6 +2,9 @@ package bybit
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -92,3 +95,54 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+// go test -v --run TestGetAccountRatio
+func TestGetAccountRatio(t *testing.T) {
+	client := NewRESTClient("https://api.bybit.com", 10*time.Second)
+
+	// Context with timeout for safety
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	end := time.Now()
+	start := end.Add(-4 * time.Hour)
+
+	resp, err := client.GetAccountRatio(ctx, "linear", "BTCUSDT", AccountRatioPeriod5Min, start, end)
+	if err != nil {
+		t.Fatalf("GetAccountRatio returned error: %v", err)
+	}
+
+	if len(resp) == 0 {
+		t.Error("Expected non-empty response body")
+	}
+	t.Logf("Received response: %v", resp)
+}
+
+// go test -v --run TestGetAccountRatioPages
+func TestGetAccountRatioPages(t *testing.T) {
+	// Two pages of newest-first samples; the second reaches back past start
+	pages := map[string]string{
+		"":   `{"list":[{"symbol":"BTCUSDT","buyRatio":"0.5","sellRatio":"0.5","timestamp":"3000"},{"symbol":"BTCUSDT","buyRatio":"0.5","sellRatio":"0.5","timestamp":"2000"}],"nextPageCursor":"p2"}`,
+		"p2": `{"list":[{"symbol":"BTCUSDT","buyRatio":"0.5","sellRatio":"0.5","timestamp":"1000"}],"nextPageCursor":"p3"}`,
+		"p3": `{"list":[],"nextPageCursor":""}`,
+	}
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"retCode":0,"retMsg":"OK","result":%s}`, pages[r.URL.Query().Get("cursor")])
+	}))
+	defer server.Close()
+
+	client := NewRESTClient(server.URL, 10*time.Second)
+	samples, err := client.GetAccountRatio(context.Background(), "linear", "BTCUSDT", AccountRatioPeriod5Min,
+		time.UnixMilli(1000), time.UnixMilli(3000))
+	if err != nil {
+		t.Fatalf("GetAccountRatio returned error: %v", err)
+	}
+	if len(samples) != 3 || samples[2].Timestamp != 1000 {
+		t.Errorf("unexpected samples: %v", samples)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2: the range was covered by the second page", requests)
+	}
+}
@@ -13,14 +13,33 @@ type BybitResponse struct {
 }
 
 type InstrumentListResponse struct {
-	Category       string `json:"category"` // e.g., "linear", "spot"
-	NextPageCursor string `json:"nextPageCursor"`
-	List           []struct {
-		Symbol    string `json:"symbol"`    // e.g., "BTCUSDT"
-		BaseCoin  string `json:"baseCoin"`  // e.g., "BTC"
-		QuoteCoin string `json:"quoteCoin"` // e.g., "USDT"
-		// ... extra
-	} `json:"list"`
+	Category       string       `json:"category"` // e.g., "linear", "spot"
+	NextPageCursor string       `json:"nextPageCursor"`
+	List           []Instrument `json:"list"`
+}
+
+// Instrument is a tradable contract as listed by instruments-info.
+type Instrument struct {
+	Symbol       string `json:"symbol"`       // e.g., "BTCUSDT"
+	ContractType string `json:"contractType"` // e.g., "LinearPerpetual", "LinearFutures"
+	Status       string `json:"status"`       // e.g., "Trading", "PreLaunch", "Delivering"
+	BaseCoin     string `json:"baseCoin"`     // e.g., "BTC"
+	QuoteCoin    string `json:"quoteCoin"`    // e.g., "USDT"
+	// ... extra
+}
+
+type TickerListResponse struct {
+	Category string   `json:"category"` // e.g., "linear", "spot"
+	List     []Ticker `json:"list"`
+}
+
+// Ticker is the 24h market snapshot of a symbol.
+type Ticker struct {
+	Symbol      string `json:"symbol"`      // e.g., "BTCUSDT"
+	LastPrice   string `json:"lastPrice"`   // Last traded price
+	Turnover24h string `json:"turnover24h"` // Traded value over the last 24 hours (in quote coin)
+	Volume24h   string `json:"volume24h"`   // Traded quantity over the last 24 hours
+	// ... extra
 }
 
 type KlinesResponse struct {
@@ -28,3 +47,16 @@ type KlinesResponse struct {
 	NextPageCursor string     `json:"nextPageCursor"`
 	List           [][]string `json:"list"`
 }
+
+type AccountRatioResponse struct {
+	List           []AccountRatio `json:"list"`
+	NextPageCursor string         `json:"nextPageCursor"`
+}
+
+// AccountRatio is one long/short account ratio sample for a symbol.
+type AccountRatio struct {
+	Symbol    string `json:"symbol"`           // e.g., "BTCUSDT"
+	BuyRatio  string `json:"buyRatio"`         // Share of accounts holding long positions
+	SellRatio string `json:"sellRatio"`        // Share of accounts holding short positions
+	Timestamp int64  `json:"timestamp,string"` // Sample time (in milliseconds since epoch)
+}
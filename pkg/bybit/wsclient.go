@@ -1,7 +1,10 @@
 package bybit
 
 import (
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"wscollector/internal/bybit/memorystore"
@@ -10,14 +13,35 @@ import (
 	"go.uber.org/zap"
 )
 
+// Bybit rejects subscribe requests with too many args, so topics are sent in chunks of this
+// size and each chunk's acknowledgement is awaited before the next is sent.
+const (
+	wsSubscribeChunk = 10
+	wsAckTimeout     = 10 * time.Second
+)
+
+// wsOpResponse is Bybit's acknowledgement of a subscribe request.
+type wsOpResponse struct {
+	Success bool   `json:"success"`
+	RetMsg  string `json:"ret_msg"`
+	ReqID   string `json:"req_id"`
+	Op      string `json:"op"`
+}
+
 // WSClient handles WebSocket connection to Bybit and message routing.
 type WSClient struct {
 	url         string
 	args        []string
 	conn        *websocket.Conn
 	handler     func([]byte)
+	nextReqID   int
 	symbolStore *memorystore.MemorySymbolStore
 	logger      *zap.Logger
+
+	mu         sync.Mutex // guards conn and listening against Close
+	listening  bool
+	closing    chan struct{}
+	listenDone chan struct{}
 }
 
 // NewClient creates a new WebSocket client with the given URL and logger.
@@ -26,6 +50,8 @@ func NewWSClient(url string, store *memorystore.MemorySymbolStore, logger *zap.L
 		url:         url,
 		symbolStore: store,
 		logger:      logger,
+		closing:     make(chan struct{}),
+		listenDone:  make(chan struct{}),
 	}
 }
 
@@ -44,35 +70,52 @@ func (c *WSClient) Connect() error {
 		c.logger.Error("Failed to connect to WebSocket", zap.String("url", c.url), zap.Error(err))
 		return err
 	}
+	c.mu.Lock()
 	c.conn = conn
+	c.mu.Unlock()
 	c.logger.Info("WebSocket connected", zap.String("url", c.url))
 
 	// Store subscription arguments for future reconnects
-	c.args = c.symbolStore.GetKlineTopics(c.symbolStore.WsInterval)
+	c.args = c.symbolStore.GetKlineTopics()
 
-	// Send subscription message
-	subMsg := map[string]interface{}{
-		"op":   "subscribe",
-		"args": c.args,
-	}
-
-	if err := conn.WriteJSON(subMsg); err != nil {
-		c.logger.Error("Failed to send subscription", zap.Error(err))
+	if err := c.subscribe(conn, c.args); err != nil {
+		c.logger.Error("Failed to subscribe", zap.Error(err))
 		return err
 	}
 
 	return nil
 }
 
+// Listen reads messages until Close is called, reconnecting after read errors.
 func (c *WSClient) Listen() {
+	c.mu.Lock()
+	if c.isClosing() {
+		c.mu.Unlock()
+		return
+	}
+	c.listening = true
+	c.mu.Unlock()
+	defer close(c.listenDone)
+
 	for {
-		_, msg, err := c.conn.ReadMessage()
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+
+		_, msg, err := conn.ReadMessage()
 		if err != nil {
+			if c.isClosing() {
+				return
+			}
 			c.logger.Error("WebSocket read error", zap.Error(err))
 
-			// Retry reconnecting indefinitely
+			// Retry reconnecting until closed
 			for {
-				time.Sleep(3 * time.Second)
+				select {
+				case <-c.closing:
+					return
+				case <-time.After(3 * time.Second):
+				}
 				if err := c.reconnectAndResubscribe(); err != nil {
 					c.logger.Warn("Retrying reconnect...")
 					continue
@@ -97,27 +140,107 @@ func (c *WSClient) reconnectAndResubscribe() error {
 		return err
 	}
 
-	// Close the old connection if it exists
-	if c.conn != nil {
-		_ = c.conn.Close()
+	// Replace the current connection unless Close won the race
+	c.mu.Lock()
+	if c.isClosing() {
+		c.mu.Unlock()
+		_ = newConn.Close()
+		return fmt.Errorf("websocket client closed")
 	}
-
-	// Replace the current connection
+	oldConn := c.conn
 	c.conn = newConn
+	c.mu.Unlock()
+
+	// Close the old connection if it exists
+	if oldConn != nil {
+		_ = oldConn.Close()
+	}
 
 	// Regenerate subscription topics based on current symbols
-	c.args = c.symbolStore.GetKlineTopics(c.symbolStore.WsInterval)
+	c.args = c.symbolStore.GetKlineTopics()
 
-	// Build subscription message payload
-	subMsg := map[string]interface{}{
-		"op":   "subscribe",
-		"args": c.args, // c.args must be stored beforehand
+	if err := c.subscribe(newConn, c.args); err != nil {
+		return fmt.Errorf("websocket subscribe failed: %w", err)
 	}
 
-	// Send the subscription message
-	if err := c.conn.WriteJSON(subMsg); err != nil {
-		return fmt.Errorf("websocket subscribe failed: %w", err)
+	return nil
+}
+
+// subscribe sends topics in chunks of wsSubscribeChunk and waits for each chunk's
+// acknowledgement. Data for topics already subscribed can arrive before a later ack;
+// it is passed to the handler so nothing is lost. It must be called before Listen reads
+// from conn.
+func (c *WSClient) subscribe(conn *websocket.Conn, topics []string) error {
+	defer conn.SetReadDeadline(time.Time{})
+
+	for from := 0; from < len(topics); from += wsSubscribeChunk {
+		chunk := topics[from:min(from+wsSubscribeChunk, len(topics))]
+		c.nextReqID++
+		reqID := strconv.Itoa(c.nextReqID)
+
+		subMsg := map[string]interface{}{
+			"req_id": reqID,
+			"op":     "subscribe",
+			"args":   chunk,
+		}
+		if err := conn.WriteJSON(subMsg); err != nil {
+			return fmt.Errorf("send subscription: %w", err)
+		}
+
+		if err := conn.SetReadDeadline(time.Now().Add(wsAckTimeout)); err != nil {
+			return err
+		}
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return fmt.Errorf("wait for subscription ack %s: %w", reqID, err)
+			}
+
+			var resp wsOpResponse
+			if json.Unmarshal(msg, &resp) == nil && resp.Op == "subscribe" && resp.ReqID == reqID {
+				if !resp.Success {
+					return fmt.Errorf("subscription to %v rejected: %s", chunk, resp.RetMsg)
+				}
+				break
+			}
+			if c.handler != nil {
+				c.handler(msg)
+			}
+		}
 	}
 
+	c.logger.Info("WebSocket subscribed", zap.Int("topics", len(topics)))
 	return nil
 }
+
+// Close stops Listen, including its reconnect loop, and closes the connection. It returns
+// once the message handler has been called for the last time.
+func (c *WSClient) Close() {
+	c.mu.Lock()
+	if c.isClosing() {
+		c.mu.Unlock()
+		return
+	}
+	close(c.closing)
+	conn, listening := c.conn, c.listening
+	c.mu.Unlock()
+
+	if conn != nil {
+		msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = conn.Close()
+	}
+	if listening {
+		<-c.listenDone
+	}
+	c.logger.Info("WebSocket closed", zap.String("url", c.url))
+}
+
+func (c *WSClient) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
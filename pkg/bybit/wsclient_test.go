@@ -0,0 +1,105 @@
+package bybit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// go test -v --run TestWSClientSubscribesInChunks
+func TestWSClientSubscribesInChunks(t *testing.T) {
+	var mu sync.Mutex
+	var chunks [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			var req struct {
+				ReqID string   `json:"req_id"`
+				Args  []string `json:"args"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			mu.Lock()
+			chunks = append(chunks, req.Args)
+			mu.Unlock()
+
+			// Data for an earlier chunk can precede the ack
+			_ = conn.WriteJSON(map[string]interface{}{"topic": req.Args[0], "data": []interface{}{}})
+			_ = conn.WriteJSON(map[string]interface{}{"op": "subscribe", "req_id": req.ReqID, "success": true})
+		}
+	}))
+	defer server.Close()
+
+	symbols := memorystore.NewSymbolStore(func(string) []string { return []string{"1", "5"} }, zap.NewNop())
+	for _, symbol := range []string{"AUSDT", "BUSDT", "CUSDT", "DUSDT", "EUSDT", "FUSDT", "GUSDT"} {
+		symbols.Add(symbol)
+	}
+
+	client := NewWSClient("ws"+strings.TrimPrefix(server.URL, "http"), symbols, zap.NewNop())
+	var handled int
+	client.SetMessageHandler(func([]byte) { handled++ })
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect returned error: %v", err)
+	}
+	defer client.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	total := 0
+	for _, chunk := range chunks {
+		if len(chunk) > wsSubscribeChunk {
+			t.Errorf("chunk of %d topics exceeds %d", len(chunk), wsSubscribeChunk)
+		}
+		total += len(chunk)
+	}
+	if total != 14 || len(chunks) != 2 {
+		t.Errorf("sent %d topics in %d chunks, want 14 in 2", total, len(chunks))
+	}
+	if handled != len(chunks) {
+		t.Errorf("handler saw %d data messages, want %d", handled, len(chunks))
+	}
+}
+
+// go test -v --run TestWSClientRejectedSubscription
+func TestWSClientRejectedSubscription(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var req struct {
+			ReqID string `json:"req_id"`
+		}
+		if conn.ReadJSON(&req) == nil {
+			_ = conn.WriteJSON(map[string]interface{}{"op": "subscribe", "req_id": req.ReqID, "success": false, "ret_msg": "args size >10"})
+		}
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	symbols := memorystore.NewSymbolStore(func(string) []string { return []string{"1"} }, zap.NewNop())
+	symbols.Add("AUSDT")
+
+	client := NewWSClient("ws"+strings.TrimPrefix(server.URL, "http"), symbols, zap.NewNop())
+	err := client.Connect()
+	if err == nil || !strings.Contains(err.Error(), "args size") {
+		t.Fatalf("expected the rejection to be returned, got %v", err)
+	}
+	client.Close()
+}
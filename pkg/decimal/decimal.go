@@ -0,0 +1,226 @@
+package decimal
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Decimal is an exact base-10 number that keeps the text it was parsed from.
+// Prices and quantities received from Bybit are carried as-is, so the value written
+// to a numeric column is byte-for-byte what the exchange sent.
+type Decimal struct {
+	s string
+}
+
+// Zero is the decimal value 0.
+var Zero = Decimal{s: "0"}
+
+// Parse validates a plain decimal string such as "0.000123" or "-42".
+// Exponent notation is rejected.
+func Parse(s string) (Decimal, error) {
+	if !isDecimal(s) {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+	return Decimal{s: s}, nil
+}
+
+// MustParse is like Parse but panics on invalid input. Intended for constants and tests.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// String returns the original text of the decimal.
+func (d Decimal) String() string {
+	return d.s
+}
+
+// IsSet reports whether the decimal holds a value (the zero Decimal{} does not).
+func (d Decimal) IsSet() bool {
+	return d.s != ""
+}
+
+// Float64 returns the nearest float64. Use only for analytics, never for storage.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.s, 64)
+	return f
+}
+
+// Cmp compares d and o numerically and returns -1, 0 or +1.
+func (d Decimal) Cmp(o Decimal) int {
+	a, b, _ := align(d, o)
+	return a.Cmp(b)
+}
+
+// Equal reports whether d and o are numerically equal (e.g., "1.50" equals "1.5").
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+// Add returns the exact sum of d and o, using the larger of the two scales.
+func (d Decimal) Add(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return fromScaled(new(big.Int).Add(a, b), scale)
+}
+
+// Sub returns the exact difference of d and o, using the larger of the two scales.
+func (d Decimal) Sub(o Decimal) Decimal {
+	a, b, scale := align(d, o)
+	return fromScaled(new(big.Int).Sub(a, b), scale)
+}
+
+// MarshalJSON encodes the decimal as a JSON string, matching Bybit's wire format.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	if !d.IsSet() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(d.s)
+}
+
+// UnmarshalJSON accepts a JSON string ("0.1") or number (0.1) and keeps its exact text.
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" || s == `""` {
+		*d = Decimal{}
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value implements driver.Valuer; the text is sent unchanged to the database.
+func (d Decimal) Value() (driver.Value, error) {
+	if !d.IsSet() {
+		return nil, nil
+	}
+	return d.s, nil
+}
+
+// Scan implements sql.Scanner for numeric columns.
+func (d *Decimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Decimal{}
+		return nil
+	case []byte:
+		return d.scanString(string(v))
+	case string:
+		return d.scanString(v)
+	case int64:
+		*d = Decimal{s: strconv.FormatInt(v, 10)}
+		return nil
+	case float64:
+		*d = Decimal{s: strconv.FormatFloat(v, 'f', -1, 64)}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Decimal", src)
+	}
+}
+
+func (d *Decimal) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// GormDataType maps Decimal to a numeric column.
+func (Decimal) GormDataType() string {
+	return "numeric"
+}
+
+// scaled returns the decimal as an integer and the number of fractional digits.
+func (d Decimal) scaled() (*big.Int, int) {
+	s := d.s
+	if s == "" {
+		return new(big.Int), 0
+	}
+
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		scale = len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+
+	n, _ := new(big.Int).SetString(strings.TrimPrefix(s, "+"), 10)
+	if n == nil {
+		n = new(big.Int)
+	}
+	return n, scale
+}
+
+// align returns both decimals scaled to a common number of fractional digits.
+func align(d, o Decimal) (*big.Int, *big.Int, int) {
+	a, as := d.scaled()
+	b, bs := o.scaled()
+
+	scale := as
+	if bs > scale {
+		scale = bs
+	}
+	a.Mul(a, pow10(scale-as))
+	b.Mul(b, pow10(scale-bs))
+	return a, b, scale
+}
+
+func fromScaled(n *big.Int, scale int) Decimal {
+	neg := n.Sign() < 0
+	digits := new(big.Int).Abs(n).String()
+
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if neg {
+		digits = "-" + digits
+	}
+	return Decimal{s: digits}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// isDecimal reports whether s is [+-]digits[.digits] with at least one digit.
+func isDecimal(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '-' || s[0] == '+' {
+		s = s[1:]
+	}
+
+	digits, dot := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c == '.' && !dot:
+			dot = true
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
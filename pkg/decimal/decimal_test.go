@@ -0,0 +1,51 @@
+package decimal
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// go test -v --run TestDecimalPreservesText
+func TestDecimalPreservesText(t *testing.T) {
+	var got struct {
+		Price Decimal `json:"price"`
+		Qty   Decimal `json:"qty"`
+	}
+	if err := json.Unmarshal([]byte(`{"price":"0.00001230","qty":12.50}`), &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Price.String() != "0.00001230" || got.Qty.String() != "12.50" {
+		t.Errorf("text not preserved: %q %q", got.Price, got.Qty)
+	}
+
+	v, err := got.Price.Value()
+	if err != nil || v != "0.00001230" {
+		t.Errorf("unexpected driver value: %v, %v", v, err)
+	}
+
+	if _, err := Parse("1e-5"); err == nil {
+		t.Error("expected error for exponent notation")
+	}
+}
+
+// go test -v --run TestDecimalArithmetic
+func TestDecimalArithmetic(t *testing.T) {
+	sum := Zero
+	for i := 0; i < 10; i++ {
+		sum = sum.Add(MustParse("0.1"))
+	}
+	if sum.String() != "1.0" {
+		t.Errorf("expected exact sum 1.0, got %s", sum)
+	}
+
+	if diff := MustParse("0.05").Sub(MustParse("0.125")); diff.String() != "-0.075" {
+		t.Errorf("unexpected difference: %s", diff)
+	}
+
+	if !MustParse("1.50").Equal(MustParse("1.5")) {
+		t.Error("expected 1.50 == 1.5")
+	}
+	if MustParse("0.0000001").Cmp(MustParse("0.00000009")) != 1 {
+		t.Error("expected 0.0000001 > 0.00000009")
+	}
+}
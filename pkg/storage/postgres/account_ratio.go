@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"wscollector/pkg/bybit"
+
+	"gorm.io/gorm/clause"
+)
+
+// InsertAccountRatios inserts account ratio samples, skipping ones already stored.
+// It returns the number of newly inserted rows.
+func (p *PostgresClient) InsertAccountRatios(ctx context.Context, records []*AccountRatioRecord) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	tx := p.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "symbol"},
+			{Name: "period"},
+			{Name: "timestamp"},
+		},
+		DoNothing: true,
+	}).Create(records)
+
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return tx.RowsAffected, nil
+}
+
+// GetLatestAccountRatioTime returns the timestamp of the newest stored sample for a symbol and period.
+// The zero time is returned when nothing is stored yet.
+func (p *PostgresClient) GetLatestAccountRatioTime(ctx context.Context, symbol, period string) (time.Time, error) {
+	var latest *time.Time
+	err := p.DB.WithContext(ctx).
+		Model(&AccountRatioRecord{}).
+		Where("symbol = ? AND period = ?", symbol, period).
+		Select("MAX(timestamp)").
+		Scan(&latest).Error
+	if err != nil || latest == nil {
+		return time.Time{}, err
+	}
+	return *latest, nil
+}
+
+// ToAccountRatioRecord converts an AccountRatio sample into an AccountRatioRecord for DB insertion.
+func ToAccountRatioRecord(period string, r bybit.AccountRatio) (*AccountRatioRecord, error) {
+	buy, err := strconv.ParseFloat(r.BuyRatio, 64)
+	if err != nil {
+		return nil, err
+	}
+	sell, err := strconv.ParseFloat(r.SellRatio, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccountRatioRecord{
+		Symbol:    r.Symbol,
+		Period:    period,
+		Timestamp: time.UnixMilli(r.Timestamp),
+		BuyRatio:  buy,
+		SellRatio: sell,
+	}, nil
+}
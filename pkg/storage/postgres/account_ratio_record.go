@@ -0,0 +1,23 @@
+package postgres
+
+import "time"
+
+// AccountRatioRecord represents a long/short account ratio sample stored in the database.
+type AccountRatioRecord struct {
+	ID uint `gorm:"primaryKey"`
+
+	// unique index
+	Symbol    string    `gorm:"type:text;not null;index:idx_account_ratio_symbol_period_timestamp,unique"`
+	Period    string    `gorm:"type:varchar(10);not null;index:idx_account_ratio_symbol_period_timestamp,unique"`
+	Timestamp time.Time `gorm:"not null;index:idx_account_ratio_symbol_period_timestamp,unique"`
+
+	BuyRatio  float64 `gorm:"type:numeric;not null"`
+	SellRatio float64 `gorm:"type:numeric;not null"`
+
+	RecordedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName overrides the default table name for GORM.
+func (AccountRatioRecord) TableName() string {
+	return "account_ratio_record"
+}
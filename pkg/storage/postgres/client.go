@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"wscollector/config"
 
@@ -13,6 +14,14 @@ import (
 
 type PostgresClient struct {
 	DB *gorm.DB
+
+	// aggregates maps DB intervals to the bucket minutes of their Timescale continuous
+	// aggregate. It is set once at startup by SetupTimescale or LoadTimescaleAggregates.
+	aggregates map[string]int
+
+	// conflictPolicy resolves confirmed klines delivered again with different values.
+	// The zero value keeps the stored row.
+	conflictPolicy ConflictPolicy
 }
 
 func NewClient(dsn string) (*PostgresClient, error) {
@@ -24,33 +33,43 @@ func NewClient(dsn string) (*PostgresClient, error) {
 	return &PostgresClient{DB: db}, nil
 }
 
-// InitializeAndMigrateKlineRecord connects to Postgres, optionally creates the DB, and runs AutoMigrate.
-func InitializeAndMigrateKlineRecord(env string, cfg config.PostgresConfig, createDB bool) (*PostgresClient, error) {
+// InitializeAndMigrate connects to Postgres and optionally creates the DB. With cfg.AutoMigrate
+// it applies pending schema migrations; otherwise it fails if any are pending, so production
+// schemas only change through the migrate command.
+func InitializeAndMigrate(env string, cfg config.PostgresConfig, createDB bool) (*PostgresClient, error) {
 	if createDB {
 		if err := CreateDatabase(cfg); err != nil {
 			return nil, fmt.Errorf("failed to create database: %w", err)
 		}
 	}
 
+	policy, err := ParseConflictPolicy(cfg.ConflictPolicy)
+	if err != nil {
+		return nil, err
+	}
+
 	client, err := NewClient(cfg.DSN(env))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
+	client.SetConflictPolicy(policy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
 
-	if err := client.AutoMigrateKlineRecord(); err != nil {
+	if !cfg.AutoMigrate {
+		if err := client.CheckSchema(ctx); err != nil {
+			return nil, fmt.Errorf("schema check failed: %w", err)
+		}
+		return client, nil
+	}
+	if _, err := client.MigrateUp(ctx); err != nil {
 		return nil, fmt.Errorf("migration failed: %w", err)
 	}
 
 	return client, nil
 }
 
-func (p *PostgresClient) AutoMigrateKlineRecord() error {
-	if err := p.DB.AutoMigrate(&KlineRecord{}); err != nil {
-		return fmt.Errorf("auto-migrate kline table: %w", err)
-	}
-	return nil
-}
-
 func (p *PostgresClient) IsHealthy(ctx context.Context) bool {
 	db, err := p.DB.DB()
 	if err != nil {
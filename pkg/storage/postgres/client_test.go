@@ -48,7 +48,7 @@ func TestPostgresClientWithConfig(t *testing.T) {
 		t.Fatal("expected healthy DB connection")
 	}
 
-	if err := client.AutoMigrateKlineRecord(); err != nil {
-		t.Fatalf("auto migration failed: %v", err)
+	if _, err := client.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("migration failed: %v", err)
 	}
 }
@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"context"
+
+	"gorm.io/gorm/clause"
+)
+
+// InsertCorrelations inserts correlation snapshots, skipping ones already stored.
+// It returns the number of newly inserted rows.
+func (p *PostgresClient) InsertCorrelations(ctx context.Context, records []*CorrelationRecord) (int64, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	tx := p.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "symbol"},
+			{Name: "benchmark"},
+			{Name: "interval"},
+			{Name: "window_size"},
+			{Name: "as_of"},
+		},
+		DoNothing: true,
+	}).Create(records)
+
+	if tx.Error != nil {
+		return 0, tx.Error
+	}
+	return tx.RowsAffected, nil
+}
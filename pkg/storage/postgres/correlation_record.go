@@ -0,0 +1,26 @@
+package postgres
+
+import "time"
+
+// CorrelationRecord is a snapshot of a symbol's rolling correlation and beta against a benchmark.
+type CorrelationRecord struct {
+	ID uint `gorm:"primaryKey"`
+
+	// unique index
+	Symbol    string    `gorm:"type:text;not null;index:idx_correlation_symbol_benchmark_interval_window_as_of,unique"`
+	Benchmark string    `gorm:"type:text;not null;index:idx_correlation_symbol_benchmark_interval_window_as_of,unique"`
+	Interval  string    `gorm:"type:varchar(10);not null;index:idx_correlation_symbol_benchmark_interval_window_as_of,unique"`
+	Window    int       `gorm:"column:window_size;not null;index:idx_correlation_symbol_benchmark_interval_window_as_of,unique"`
+	AsOf      time.Time `gorm:"not null;index:idx_correlation_symbol_benchmark_interval_window_as_of,unique"`
+
+	Correlation float64 `gorm:"not null"`
+	Beta        float64 `gorm:"not null"`
+	Samples     int     `gorm:"not null"`
+
+	RecordedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// TableName overrides the default table name for GORM.
+func (CorrelationRecord) TableName() string {
+	return "correlation_record"
+}
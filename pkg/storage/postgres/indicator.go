@@ -0,0 +1,25 @@
+package postgres
+
+import (
+	"context"
+
+	"gorm.io/gorm/clause"
+)
+
+// UpsertIndicators stores indicator values, replacing values already stored for the
+// same symbol, interval, start and name (e.g., after a restart recomputes them).
+func (p *PostgresClient) UpsertIndicators(ctx context.Context, records []*IndicatorRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return p.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "symbol"},
+			{Name: "interval"},
+			{Name: "start"},
+			{Name: "name"},
+		},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "recorded_at"}),
+	}).Create(records).Error
+}
@@ -0,0 +1,23 @@
+package postgres
+
+import "time"
+
+// IndicatorRecord is one indicator value for a candle, keyed like KlineRecord.
+type IndicatorRecord struct {
+	ID uint `gorm:"primaryKey"`
+
+	// unique index
+	Symbol   string    `gorm:"type:text;not null;index:idx_indicator_symbol_interval_start_name,unique"`
+	Interval string    `gorm:"type:varchar(10);not null;index:idx_indicator_symbol_interval_start_name,unique"`
+	Start    time.Time `gorm:"not null;index:idx_indicator_symbol_interval_start_name,unique"`
+	Name     string    `gorm:"type:varchar(32);not null;index:idx_indicator_symbol_interval_start_name,unique"`
+
+	Value float64 `gorm:"not null"`
+
+	RecordedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+// TableName overrides the default table name for GORM.
+func (IndicatorRecord) TableName() string {
+	return "indicator_record"
+}
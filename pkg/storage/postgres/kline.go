@@ -3,40 +3,56 @@ package postgres
 import (
 	"context"
 	"fmt"
-	"strconv"
 	"time"
 
 	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
 
 	"gorm.io/gorm/clause"
 )
 
-func (p *PostgresClient) InsertKline(ctx context.Context, record *KlineRecord) error {
-	tx := p.DB.WithContext(ctx).Clauses(clause.OnConflict{
-		Columns: []clause.Column{
-			{Name: "symbol"},
-			{Name: "interval"},
-			{Name: "start"},
-			{Name: "confirm"},
-		},
-		DoNothing: true,
-	}).Create(record)
-
-	if tx.Error != nil {
-		return tx.Error
-	}
+// klineConflictColumns is the unique key of kline_record.
+var klineConflictColumns = []clause.Column{
+	{Name: "symbol"},
+	{Name: "interval"},
+	{Name: "price_type"},
+	{Name: "start"},
+}
 
-	if tx.RowsAffected == 0 {
-		return fmt.Errorf(
-			"duplicate kline skipped: symbol=%s interval=%s start=%s confirm=%t",
-			record.Symbol,
-			record.Interval,
-			record.Start.Format(time.RFC3339),
-			record.Confirm,
-		)
+// klineValueColumns are overwritten when a forming row is updated or confirmed.
+var klineValueColumns = []string{
+	"end", "open", "close", "high", "low", "volume", "turnover", "confirm", "timestamp",
+}
+
+// InsertKline stores a confirmed kline and reports what happened to it. A forming
+// (unconfirmed) row for the same candle is replaced; a candle that is already confirmed is
+// a duplicate or, if its values differ, a conflict resolved by the client's ConflictPolicy.
+// Duplicates and conflicts are outcomes, not errors.
+func (p *PostgresClient) InsertKline(ctx context.Context, record *KlineRecord) (KlineOutcome, error) {
+	outcomes, err := p.InsertKlines(ctx, []*KlineRecord{record})
+	if err != nil {
+		return 0, err
 	}
+	return outcomes[0], nil
+}
+
+// UpsertLiveKline writes the latest state of a forming candle. It is a no-op once
+// the candle has been confirmed, so a late update cannot overwrite the final row.
+func (p *PostgresClient) UpsertLiveKline(ctx context.Context, record *KlineRecord) error {
+	record.Confirm = false
 
-	return nil
+	return p.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   klineConflictColumns,
+		DoUpdates: clause.AssignmentColumns(klineValueColumns),
+		Where:     formingRowOnly(),
+	}).Create(record).Error
+}
+
+// formingRowOnly restricts ON CONFLICT updates to rows that are not yet confirmed.
+func formingRowOnly() clause.Where {
+	return clause.Where{Exprs: []clause.Expression{
+		clause.Expr{SQL: "kline_record.confirm = ?", Vars: []interface{}{false}},
+	}}
 }
 
 // example methods
@@ -52,6 +68,33 @@ func (p *PostgresClient) GetKline(ctx context.Context, symbol, interval string,
 	return &kline, nil
 }
 
+// GetKlineRange returns the confirmed last-traded klines of the given symbols at one interval
+// with start in [from, to), ordered by symbol and start. It reads along the unique index.
+// With a Timescale aggregate for the interval, complete aggregated candles fill the gaps
+// between stored rows.
+func (p *PostgresClient) GetKlineRange(ctx context.Context, symbols []string, interval string,
+	from, to time.Time) ([]KlineRecord, error) {
+	var klines []KlineRecord
+	err := p.DB.WithContext(ctx).
+		Where("symbol IN ? AND interval = ? AND price_type = ? AND start >= ? AND start < ? AND confirm = ?",
+			symbols, interval, "last", from, to, true).
+		Order("symbol, start").
+		Find(&klines).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.aggregates[interval]; ok {
+		aggregated, err := p.GetAggregatedKlines(ctx, symbols, interval, from, to)
+		if err != nil {
+			return nil, err
+		}
+		klines = mergeAggregated(klines, aggregated)
+	}
+	return klines, nil
+}
+
 func (p *PostgresClient) UpdateKlineConfirm(ctx context.Context, id uint, confirm bool) error {
 	return p.DB.WithContext(ctx).
 		Model(&KlineRecord{}).
@@ -66,44 +109,52 @@ func (p *PostgresClient) DeleteOldKlines(ctx context.Context, before time.Time)
 }
 
 // ToKlineRecord converts a Kline and symbol into a KlineRecord for DB insertion.
+// Prices are copied as exact decimals; a kline with a missing price is rejected.
 func ToKlineRecord(symbol string, k memorystore.Kline) (*KlineRecord, error) {
-	open, err := strconv.ParseFloat(k.Open, 64)
-	if err != nil {
-		return nil, err
-	}
-	closePrice, err := strconv.ParseFloat(k.Close, 64)
-	if err != nil {
-		return nil, err
-	}
-	high, err := strconv.ParseFloat(k.High, 64)
-	if err != nil {
-		return nil, err
-	}
-	low, err := strconv.ParseFloat(k.Low, 64)
-	if err != nil {
-		return nil, err
-	}
-	volume, err := strconv.ParseFloat(k.Volume, 64)
-	if err != nil {
-		return nil, err
-	}
-	turnover, err := strconv.ParseFloat(k.Turnover, 64)
-	if err != nil {
-		return nil, err
+	// In column order, so the first missing field is always the one reported
+	for _, field := range []struct {
+		name  string
+		value decimal.Decimal
+	}{
+		{"open", k.Open}, {"close", k.Close}, {"high", k.High}, {"low", k.Low},
+		{"volume", k.Volume}, {"turnover", k.Turnover},
+	} {
+		if !field.value.IsSet() {
+			return nil, fmt.Errorf("kline %s %d missing %s", symbol, k.Start, field.name)
+		}
 	}
 
 	return &KlineRecord{
 		Symbol:    symbol,
 		Interval:  k.Interval,
+		PriceType: k.PriceType,
 		Start:     time.UnixMilli(k.Start),
 		End:       time.UnixMilli(k.End),
-		Open:      open,
-		Close:     closePrice,
-		High:      high,
-		Low:       low,
-		Volume:    volume,
-		Turnover:  turnover,
+		Open:      k.Open,
+		Close:     k.Close,
+		High:      k.High,
+		Low:       k.Low,
+		Volume:    k.Volume,
+		Turnover:  k.Turnover,
 		Confirm:   k.Confirm,
 		Timestamp: time.UnixMilli(k.Timestamp),
 	}, nil
 }
+
+// FromKlineRecord converts a stored KlineRecord back into a Kline.
+func FromKlineRecord(r KlineRecord) memorystore.Kline {
+	return memorystore.Kline{
+		Start:     r.Start.UnixMilli(),
+		End:       r.End.UnixMilli(),
+		Interval:  r.Interval,
+		PriceType: r.PriceType,
+		Open:      r.Open,
+		Close:     r.Close,
+		High:      r.High,
+		Low:       r.Low,
+		Volume:    r.Volume,
+		Turnover:  r.Turnover,
+		Confirm:   r.Confirm,
+		Timestamp: r.Timestamp.UnixMilli(),
+	}
+}
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// KlineOutcome is what InsertKline and InsertKlines did with one record.
+type KlineOutcome int
+
+const (
+	// KlineInserted means the record was stored as a new row or confirmed a forming row.
+	KlineInserted KlineOutcome = iota + 1
+	// KlineDuplicate means the candle was already confirmed with the same values. A forming
+	// record for a confirmed candle is also a duplicate; it never replaces the final row.
+	KlineDuplicate
+	// KlineConflict means the candle was already confirmed with different values. The
+	// client's ConflictPolicy decided which version was kept.
+	KlineConflict
+)
+
+func (o KlineOutcome) String() string {
+	switch o {
+	case KlineInserted:
+		return "inserted"
+	case KlineDuplicate:
+		return "duplicate"
+	case KlineConflict:
+		return "conflict"
+	default:
+		return fmt.Sprintf("KlineOutcome(%d)", int(o))
+	}
+}
+
+// ConflictPolicy decides what happens when a confirmed kline arrives again with values
+// that differ from the stored row, e.g. after Bybit corrects a candle.
+type ConflictPolicy string
+
+const (
+	ConflictKeep      ConflictPolicy = "keep"      // keep the stored row (default)
+	ConflictOverwrite ConflictPolicy = "overwrite" // replace the stored row with the new values
+	ConflictRevision  ConflictPolicy = "revision"  // keep the stored row and append the new values to kline_revision
+)
+
+// ParseConflictPolicy validates a configured policy; an empty string is ConflictKeep.
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(s); policy {
+	case "":
+		return ConflictKeep, nil
+	case ConflictKeep, ConflictOverwrite, ConflictRevision:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown kline conflict policy %q: use keep, overwrite or revision", s)
+	}
+}
+
+// SetConflictPolicy sets how conflicting confirmed klines are resolved. It is meant to be
+// called once at startup, before klines are written.
+func (p *PostgresClient) SetConflictPolicy(policy ConflictPolicy) {
+	p.conflictPolicy = policy
+}
+
+// klineKey identifies a candle by the unique index of kline_record.
+type klineKey struct {
+	symbol, interval, priceType string
+	start                       int64
+}
+
+func keyOf(r *KlineRecord) klineKey {
+	return klineKey{r.Symbol, r.Interval, r.PriceType, r.Start.UnixMilli()}
+}
+
+// confirmedKlines reads the confirmed rows for the records' candles. It selects the
+// bounding box of the batch along the unique index, which is tight for both live batches
+// (one minute, many symbols) and backfills (one symbol, many minutes), and matches exact
+// keys in memory.
+func confirmedKlines(tx *gorm.DB, records []*KlineRecord) (map[klineKey]KlineRecord, error) {
+	var symbols, intervals, priceTypes []string
+	from, to := records[0].Start, records[0].Start
+	for _, r := range records {
+		if !slices.Contains(symbols, r.Symbol) {
+			symbols = append(symbols, r.Symbol)
+		}
+		if !slices.Contains(intervals, r.Interval) {
+			intervals = append(intervals, r.Interval)
+		}
+		if !slices.Contains(priceTypes, r.PriceType) {
+			priceTypes = append(priceTypes, r.PriceType)
+		}
+		from = minTime(from, r.Start)
+		to = maxTime(to, r.Start)
+	}
+
+	var rows []KlineRecord
+	err := tx.Where("symbol IN ? AND interval IN ? AND price_type IN ? AND start >= ? AND start <= ? AND confirm = ?",
+		symbols, intervals, priceTypes, from, to, true).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("read confirmed klines: %w", err)
+	}
+
+	wanted := make(map[klineKey]bool, len(records))
+	for _, r := range records {
+		wanted[keyOf(r)] = true
+	}
+	stored := make(map[klineKey]KlineRecord, len(rows))
+	for _, row := range rows {
+		if k := keyOf(&row); wanted[k] {
+			stored[k] = row
+		}
+	}
+	return stored, nil
+}
+
+// sameKlineValues reports whether two versions of a candle carry the same prices and
+// volumes. Timestamp is when Bybit sent the message, so it differs between deliveries.
+func sameKlineValues(a, b *KlineRecord) bool {
+	return a.End.Equal(b.End) &&
+		a.Open.Equal(b.Open) && a.Close.Equal(b.Close) &&
+		a.High.Equal(b.High) && a.Low.Equal(b.Low) &&
+		a.Volume.Equal(b.Volume) && a.Turnover.Equal(b.Turnover)
+}
+
+// resolveConflicts applies the client's ConflictPolicy to confirmed records whose stored
+// row has different values.
+func (p *PostgresClient) resolveConflicts(tx *gorm.DB, conflicts []*KlineRecord) error {
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	switch p.conflictPolicy {
+	case ConflictOverwrite:
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   klineConflictColumns,
+			DoUpdates: clause.AssignmentColumns(klineValueColumns),
+		}).CreateInBatches(conflicts, maxKlineBatch).Error
+		if err != nil {
+			return fmt.Errorf("overwrite conflicting klines: %w", err)
+		}
+
+	case ConflictRevision:
+		revisions := make([]KlineRevision, len(conflicts))
+		for i, r := range conflicts {
+			revisions[i] = KlineRevision{
+				Symbol:    r.Symbol,
+				Interval:  r.Interval,
+				PriceType: r.PriceType,
+				Start:     r.Start,
+				End:       r.End,
+				Open:      r.Open,
+				Close:     r.Close,
+				High:      r.High,
+				Low:       r.Low,
+				Volume:    r.Volume,
+				Turnover:  r.Turnover,
+				Timestamp: r.Timestamp,
+			}
+		}
+		if err := tx.CreateInBatches(revisions, maxKlineBatch).Error; err != nil {
+			return fmt.Errorf("record kline revisions: %w", err)
+		}
+	}
+	return nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
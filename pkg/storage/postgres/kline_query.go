@@ -0,0 +1,228 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// defaultCursorBatch is the page size of a KlineCursor when none is given.
+const defaultCursorBatch = 1000
+
+// KlineQuery selects the klines of one series. All filters lead with the columns of the
+// unique index (symbol, interval, price_type, start), so a query is one index range scan
+// in either direction and LIMIT stops it early.
+type KlineQuery struct {
+	Symbol    string
+	Interval  string
+	PriceType string // defaults to "last"
+
+	// start in [From, To); a zero bound leaves that side open
+	From time.Time
+	To   time.Time
+
+	Limit          int  // 0 returns every match
+	Desc           bool // newest first
+	IncludeForming bool // also return candles that are not yet confirmed
+}
+
+// scope applies the query's filters and order, but not its limit.
+func (q KlineQuery) scope(db *gorm.DB) *gorm.DB {
+	priceType := q.PriceType
+	if priceType == "" {
+		priceType = "last"
+	}
+	db = db.Where("symbol = ? AND interval = ? AND price_type = ?", q.Symbol, q.Interval, priceType)
+	if !q.From.IsZero() {
+		db = db.Where("start >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		db = db.Where("start < ?", q.To)
+	}
+	if !q.IncludeForming {
+		db = db.Where("confirm = ?", true)
+	}
+	if q.Desc {
+		return db.Order("start DESC")
+	}
+	return db.Order("start")
+}
+
+// QueryKlines returns the stored klines matching q. Unlike GetKlineRange it never reads
+// Timescale aggregates, so the result is exactly what the collector wrote.
+func (p *PostgresClient) QueryKlines(ctx context.Context, q KlineQuery) ([]KlineRecord, error) {
+	db := q.scope(p.DB.WithContext(ctx))
+	if q.Limit > 0 {
+		db = db.Limit(q.Limit)
+	}
+
+	var klines []KlineRecord
+	if err := db.Find(&klines).Error; err != nil {
+		return nil, err
+	}
+	return klines, nil
+}
+
+// LatestKlines returns the newest confirmed kline of each symbol at one interval and price
+// type, keyed by symbol. Symbols without any kline are absent from the map.
+func (p *PostgresClient) LatestKlines(ctx context.Context, symbols []string, interval, priceType string) (map[string]KlineRecord, error) {
+	klines, err := p.lastKlines(ctx, symbols, interval, priceType, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[string]KlineRecord, len(klines))
+	for _, k := range klines {
+		latest[k.Symbol] = k
+	}
+	return latest, nil
+}
+
+// KlineCrossSection returns, for each symbol, the confirmed kline of one interval and price
+// type that contains at, ordered by symbol. Symbols with no candle covering at are skipped,
+// so the result never mixes in an older candle.
+func (p *PostgresClient) KlineCrossSection(ctx context.Context, symbols []string, interval, priceType string,
+	at time.Time) ([]KlineRecord, error) {
+	klines, err := p.lastKlines(ctx, symbols, interval, priceType, at)
+	if err != nil {
+		return nil, err
+	}
+	section := klines[:0]
+	for _, k := range klines {
+		if !k.End.Before(at) {
+			section = append(section, k)
+		}
+	}
+	return section, nil
+}
+
+// lastKlines finds each symbol's newest confirmed kline, starting at or before at unless at
+// is zero. The lateral subquery walks the unique index backwards once per symbol instead of
+// scanning and sorting every row of the interval.
+func (p *PostgresClient) lastKlines(ctx context.Context, symbols []string, interval, priceType string,
+	at time.Time) ([]KlineRecord, error) {
+	if len(symbols) == 0 {
+		return nil, nil
+	}
+	if priceType == "" {
+		priceType = "last"
+	}
+
+	latest := p.DB.Model(&KlineRecord{}).
+		Where("symbol = s.symbol AND interval = ? AND price_type = ? AND confirm = ?", interval, priceType, true)
+	if !at.IsZero() {
+		latest = latest.Where("start <= ?", at)
+	}
+	latest = latest.Order("start DESC").Limit(1)
+
+	var klines []KlineRecord
+	err := p.DB.WithContext(ctx).
+		Table("unnest(?::text[]) AS s(symbol)", pq.StringArray(symbols)).
+		Joins("CROSS JOIN LATERAL (?) AS kline_record", latest).
+		Select("kline_record.*").
+		Order("kline_record.symbol").
+		Find(&klines).Error
+	if err != nil {
+		return nil, err
+	}
+	return klines, nil
+}
+
+// KlineCursor streams the result of a KlineQuery page by page for exports too large to
+// hold in memory. Each page is a separate keyset query continuing after the last start
+// seen, so no transaction or connection is held between pages and it needs no Close.
+// Concurrent writes cannot shift the pages. It is not safe for concurrent use.
+type KlineCursor struct {
+	client *PostgresClient
+	ctx    context.Context
+	query  KlineQuery
+	batch  int
+
+	page []KlineRecord
+	pos  int
+	read int
+	last time.Time
+	done bool
+	err  error
+}
+
+// StreamKlines returns a cursor over the klines matching q, fetched batch rows at a time.
+// q.Limit still caps the total.
+func (p *PostgresClient) StreamKlines(ctx context.Context, q KlineQuery, batch int) *KlineCursor {
+	if batch <= 0 {
+		batch = defaultCursorBatch
+	}
+	return &KlineCursor{client: p, ctx: ctx, query: q, batch: batch, pos: -1}
+}
+
+// Next advances to the next kline and reports whether there is one. After it returns
+// false, Err reports whether the cursor ended because of an error.
+func (c *KlineCursor) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	if c.pos+1 < len(c.page) {
+		c.pos++
+		return true
+	}
+	if c.done {
+		return false
+	}
+
+	if err := c.fetch(); err != nil {
+		c.err = err
+		return false
+	}
+	if len(c.page) == 0 {
+		c.done = true
+		return false
+	}
+	c.pos = 0
+	return true
+}
+
+// fetch loads the page following the last kline returned.
+func (c *KlineCursor) fetch() error {
+	limit := c.batch
+	if c.query.Limit > 0 {
+		limit = min(limit, c.query.Limit-c.read)
+		if limit <= 0 {
+			c.page = nil
+			return nil
+		}
+	}
+
+	db := c.query.scope(c.client.DB.WithContext(c.ctx))
+	if c.read > 0 {
+		if c.query.Desc {
+			db = db.Where("start < ?", c.last)
+		} else {
+			db = db.Where("start > ?", c.last)
+		}
+	}
+
+	var page []KlineRecord
+	if err := db.Limit(limit).Find(&page).Error; err != nil {
+		return err
+	}
+	c.page = page
+	c.read += len(page)
+	if len(page) > 0 {
+		c.last = page[len(page)-1].Start
+	}
+	if len(page) < limit {
+		c.done = true
+	}
+	return nil
+}
+
+// Kline returns the kline Next advanced to.
+func (c *KlineCursor) Kline() KlineRecord {
+	return c.page[c.pos]
+}
+
+// Err returns the error that ended iteration, if any.
+func (c *KlineCursor) Err() error {
+	return c.err
+}
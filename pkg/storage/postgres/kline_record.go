@@ -1,26 +1,34 @@
 package postgres
 
-import "time"
+import (
+	"time"
 
-// KlineRecord represents a finalized candlestick stored in the database.
+	"wscollector/pkg/decimal"
+)
+
+// KlineRecord represents a candlestick stored in the database.
+// Each symbol/interval/price type/start has one row, which is either forming or finalized.
 type KlineRecord struct {
 	ID uint `gorm:"primaryKey"`
 
 	// unique index
-	Symbol   string    `gorm:"type:text;not null;index:idx_kline_symbol;index:idx_symbol_interval_start_confirm,unique"`
-	Interval string    `gorm:"type:varchar(10);not null;index:idx_symbol_interval_start_confirm,unique"`
-	Start    time.Time `gorm:"not null;index:idx_symbol_interval_start_confirm,unique"`
-	Confirm  bool      `gorm:"not null;index:idx_symbol_interval_start_confirm,unique"`
+	Symbol    string    `gorm:"type:text;not null;index:idx_kline_symbol;index:idx_symbol_interval_price_type_start,unique"`
+	Interval  string    `gorm:"type:varchar(10);not null;index:idx_symbol_interval_price_type_start,unique"`
+	PriceType string    `gorm:"type:varchar(16);not null;default:last;index:idx_symbol_interval_price_type_start,unique"`
+	Start     time.Time `gorm:"not null;index:idx_symbol_interval_price_type_start,unique"`
+
+	// false while the candle is still forming; the confirmed row replaces it in place
+	Confirm bool `gorm:"not null"`
 
 	End time.Time `gorm:"not null"`
 
-	Open  float64 `gorm:"type:numeric;not null"`
-	Close float64 `gorm:"type:numeric;not null"`
-	High  float64 `gorm:"type:numeric;not null"`
-	Low   float64 `gorm:"type:numeric;not null"`
+	Open  decimal.Decimal `gorm:"type:numeric;not null"`
+	Close decimal.Decimal `gorm:"type:numeric;not null"`
+	High  decimal.Decimal `gorm:"type:numeric;not null"`
+	Low   decimal.Decimal `gorm:"type:numeric;not null"`
 
-	Volume   float64 `gorm:"type:numeric;not null"`
-	Turnover float64 `gorm:"type:numeric;not null"`
+	Volume   decimal.Decimal `gorm:"type:numeric;not null"`
+	Turnover decimal.Decimal `gorm:"type:numeric;not null"`
 
 	Timestamp time.Time `gorm:"not null;index:idx_kline_timestamp"`
 
@@ -31,3 +39,30 @@ type KlineRecord struct {
 func (KlineRecord) TableName() string {
 	return "kline_record"
 }
+
+// KlineRevision is a confirmed kline delivered again with different values while the
+// conflict policy is ConflictRevision. The original row in kline_record is left as is.
+type KlineRevision struct {
+	ID uint `gorm:"primaryKey"`
+
+	Symbol    string    `gorm:"type:text;not null"`
+	Interval  string    `gorm:"type:varchar(10);not null"`
+	PriceType string    `gorm:"type:varchar(16);not null"`
+	Start     time.Time `gorm:"not null"`
+	End       time.Time `gorm:"not null"`
+
+	Open     decimal.Decimal `gorm:"type:numeric;not null"`
+	Close    decimal.Decimal `gorm:"type:numeric;not null"`
+	High     decimal.Decimal `gorm:"type:numeric;not null"`
+	Low      decimal.Decimal `gorm:"type:numeric;not null"`
+	Volume   decimal.Decimal `gorm:"type:numeric;not null"`
+	Turnover decimal.Decimal `gorm:"type:numeric;not null"`
+
+	Timestamp time.Time `gorm:"not null"`
+
+	RecordedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (KlineRevision) TableName() string {
+	return "kline_revision"
+}
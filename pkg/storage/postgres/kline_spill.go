@@ -0,0 +1,458 @@
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSpillFull is returned by KlineSpill.Append when the spill has reached MaxBytes.
+var ErrSpillFull = errors.New("kline spill full")
+
+// ErrRejectBatch is wrapped by a Replay write function for a batch that can never be
+// written, e.g. one violating a constraint. Replay moves it to the quarantine file and goes on.
+var ErrRejectBatch = errors.New("kline batch rejected")
+
+// spillQuarantine is the file in the spill directory that rejected batches are moved to,
+// in the segment format, for inspection and manual repair.
+const spillQuarantine = "quarantine.spill"
+
+var spillSegmentName = regexp.MustCompile(`^(\d{16})\.spill$`)
+
+// KlineSpillConfig sizes a KlineSpill. Zero values use the defaults noted per field.
+type KlineSpillConfig struct {
+	Dir          string // directory of the segment files, created if missing
+	SegmentBytes int64  // size at which the active segment is sealed (default 16 MiB)
+	MaxBytes     int64  // total size of all segments before Append fails (default 1 GiB)
+}
+
+// KlineSpillStats are the spill's size and cumulative counters since it was opened.
+type KlineSpillStats struct {
+	Segments    int
+	Bytes       int64
+	Spilled     int64 // rows appended
+	Replayed    int64 // rows written to Postgres from the spill
+	Rejected    int64 // rows refused because the spill was full
+	Quarantined int64 // rows Postgres rejected during replay, moved to the quarantine file
+	Corrupt     int64 // unreadable entries skipped during replay, e.g. torn by a crash
+}
+
+// KlineSpill is a disk-backed write-ahead log for confirmed klines that could not be
+// written to Postgres. Batches are appended as checksummed JSON lines to numbered segment
+// files and synced before Append returns; Replay writes them back oldest first and removes
+// each segment once every entry in it is written. Segments left by a previous run are
+// picked up by OpenKlineSpill, so candles survive a restart during an outage.
+//
+// Append and Replay may run concurrently; Replay itself must not.
+type KlineSpill struct {
+	cfg KlineSpillConfig
+
+	mu       sync.Mutex // guards the fields below
+	segments []spillSegment
+	active   *os.File // last segment, open for appending; nil until the next Append
+	bytes    int64
+	nextSeq  uint64
+
+	spilled     atomic.Int64
+	replayed    atomic.Int64
+	rejected    atomic.Int64
+	quarantined atomic.Int64
+	corrupt     atomic.Int64
+}
+
+// spillSegment is one segment file. offset is how far Replay has written it back.
+type spillSegment struct {
+	seq    uint64
+	size   int64
+	offset int64
+}
+
+// OpenKlineSpill opens the spill directory and resumes the segments already in it.
+func OpenKlineSpill(cfg KlineSpillConfig) (*KlineSpill, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("kline spill needs a directory")
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = 16 << 20
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 1 << 30
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spill directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spill directory: %w", err)
+	}
+	s := &KlineSpill{cfg: cfg, nextSeq: 1}
+	for _, entry := range entries {
+		match := spillSegmentName.FindStringSubmatch(entry.Name())
+		if match == nil || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("stat spill segment: %w", err)
+		}
+		seq, _ := strconv.ParseUint(match[1], 10, 64)
+		s.segments = append(s.segments, spillSegment{seq: seq, size: info.Size()})
+		s.bytes += info.Size()
+		s.nextSeq = max(s.nextSeq, seq+1)
+	}
+	slices.SortFunc(s.segments, func(a, b spillSegment) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return s, nil
+}
+
+// Append durably adds one batch of records. It fails with ErrSpillFull once the spill
+// holds MaxBytes, so a long outage cannot fill the disk.
+func (s *KlineSpill) Append(records []*KlineRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	line, err := encodeSpillEntry(records)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.bytes+int64(len(line)) > s.cfg.MaxBytes {
+		s.rejected.Add(int64(len(records)))
+		return fmt.Errorf("%w: %d bytes", ErrSpillFull, s.bytes)
+	}
+	if s.active == nil || s.segments[len(s.segments)-1].size >= s.cfg.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	seg := &s.segments[len(s.segments)-1]
+	if _, err := s.active.Write(line); err != nil {
+		return s.abandonAppend(seg, fmt.Errorf("append to spill: %w", err))
+	}
+	if err := s.active.Sync(); err != nil {
+		return s.abandonAppend(seg, fmt.Errorf("sync spill: %w", err))
+	}
+	seg.size += int64(len(line))
+	s.bytes += int64(len(line))
+	s.spilled.Add(int64(len(records)))
+	return nil
+}
+
+// abandonAppend cuts a failed entry off the active segment and seals it, so the next Append
+// starts a new file instead of writing after a possibly torn line. If the entry cannot be
+// cut off, the segment's size is taken from the file; replay skips a torn line as corrupt.
+func (s *KlineSpill) abandonAppend(seg *spillSegment, err error) error {
+	truncErr := s.active.Truncate(seg.size)
+	if truncErr != nil {
+		if info, statErr := s.active.Stat(); statErr == nil && info.Size() > seg.size {
+			s.bytes += info.Size() - seg.size
+			seg.size = info.Size()
+		}
+	}
+	closeErr := s.active.Close()
+	s.active = nil
+	return errors.Join(err, truncErr, closeErr)
+}
+
+// rotate seals the active segment and starts a new one. Segments from a previous run are
+// never appended to, so a torn last line stays at the end of its file.
+func (s *KlineSpill) rotate() error {
+	if s.active != nil {
+		if err := s.active.Close(); err != nil {
+			return fmt.Errorf("close spill segment: %w", err)
+		}
+		s.active = nil
+	}
+	f, err := os.OpenFile(s.segmentPath(s.nextSeq), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create spill segment: %w", err)
+	}
+	// Sync the directory too, or a crash could lose the new file with entries synced into it
+	if err := syncDir(s.cfg.Dir); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("sync spill directory: %w", err)
+	}
+	s.active = f
+	s.segments = append(s.segments, spillSegment{seq: s.nextSeq})
+	s.nextSeq++
+	return nil
+}
+
+// Pending reports whether the spill holds records not yet replayed.
+func (s *KlineSpill) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, seg := range s.segments {
+		if seg.offset < seg.size {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay writes the spilled records back in the order they were appended, up to batch
+// records per call to write, and returns how many rows it wrote. It stops at the first
+// error and resumes from the failed batch on the next call; entries before it are not
+// written twice while the process lives. A batch failing with ErrRejectBatch is moved to
+// the quarantine file instead. Replayed segments are deleted.
+func (s *KlineSpill) Replay(ctx context.Context, batch int,
+	write func(context.Context, []*KlineRecord) error) (int, error) {
+	if batch <= 0 {
+		batch = maxKlineBatch
+	}
+
+	total := 0
+	for {
+		seg, ok, err := s.oldestSegment()
+		if err != nil || !ok {
+			return total, err
+		}
+		n, err := s.replaySegment(ctx, seg, batch, write)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if err := s.removeSegment(seg.seq); err != nil {
+			return total, err
+		}
+	}
+}
+
+// oldestSegment returns the first segment, sealing it first if it is the active one.
+func (s *KlineSpill) oldestSegment() (spillSegment, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 {
+		return spillSegment{}, false, nil
+	}
+	if len(s.segments) == 1 && s.active != nil {
+		if s.segments[0].size == 0 {
+			return spillSegment{}, false, nil // freshly rotated and still empty
+		}
+		if err := s.rotate(); err != nil {
+			return spillSegment{}, false, err
+		}
+	}
+	return s.segments[0], true, nil
+}
+
+// replaySegment writes a sealed segment back from its recorded offset.
+func (s *KlineSpill) replaySegment(ctx context.Context, seg spillSegment, batch int,
+	write func(context.Context, []*KlineRecord) error) (int, error) {
+	f, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return 0, fmt.Errorf("open spill segment: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(seg.offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek spill segment: %w", err)
+	}
+
+	written := 0
+	offset := seg.offset
+	var pending []*KlineRecord
+	var pendingEnd int64
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		err := write(ctx, dedupeKlines(pending))
+		switch {
+		case errors.Is(err, ErrRejectBatch):
+			if err := s.quarantine(pending); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			written += len(pending)
+			s.replayed.Add(int64(len(pending)))
+		}
+		s.setOffset(seg.seq, pendingEnd)
+		pending = pending[:0]
+		return nil
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				s.corrupt.Add(1) // torn by a crash during Append
+			}
+			return written, flush()
+		}
+		if err != nil {
+			return written, fmt.Errorf("read spill segment: %w", err)
+		}
+		offset += int64(len(line))
+
+		records, err := decodeSpillEntry(line)
+		if err != nil {
+			s.corrupt.Add(1)
+			continue
+		}
+		if len(pending) > 0 && len(pending)+len(records) > batch {
+			if err := flush(); err != nil {
+				return written, err
+			}
+		}
+		pending = append(pending, records...)
+		pendingEnd = offset
+	}
+}
+
+// quarantine appends a rejected batch to the quarantine file and syncs it.
+func (s *KlineSpill) quarantine(records []*KlineRecord) error {
+	line, err := encodeSpillEntry(records)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.cfg.Dir, spillQuarantine), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open spill quarantine: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(line); err != nil {
+		return fmt.Errorf("write spill quarantine: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("sync spill quarantine: %w", err)
+	}
+	s.quarantined.Add(int64(len(records)))
+	return nil
+}
+
+func (s *KlineSpill) setOffset(seq uint64, offset int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.segments {
+		if s.segments[i].seq == seq {
+			s.segments[i].offset = offset
+		}
+	}
+}
+
+func (s *KlineSpill) removeSegment(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(s.segmentPath(seq)); err != nil {
+		return fmt.Errorf("remove spill segment: %w", err)
+	}
+	s.segments = slices.DeleteFunc(s.segments, func(seg spillSegment) bool {
+		if seg.seq == seq {
+			s.bytes -= seg.size
+			return true
+		}
+		return false
+	})
+	return nil
+}
+
+// Stats returns the spill's current size and counters.
+func (s *KlineSpill) Stats() KlineSpillStats {
+	s.mu.Lock()
+	segments, size := len(s.segments), s.bytes
+	s.mu.Unlock()
+
+	return KlineSpillStats{
+		Segments:    segments,
+		Bytes:       size,
+		Spilled:     s.spilled.Load(),
+		Replayed:    s.replayed.Load(),
+		Rejected:    s.rejected.Load(),
+		Quarantined: s.quarantined.Load(),
+		Corrupt:     s.corrupt.Load(),
+	}
+}
+
+// Close closes the active segment. Unreplayed segments stay on disk for the next run.
+func (s *KlineSpill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (s *KlineSpill) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%016d.spill", seq))
+}
+
+// encodeSpillEntry encodes a batch as "<crc32 hex> <json>\n". IDs and recorded_at are
+// cleared; they are assigned again when the rows are replayed.
+func encodeSpillEntry(records []*KlineRecord) ([]byte, error) {
+	rows := make([]KlineRecord, len(records))
+	for i, r := range records {
+		rows[i] = *r
+		rows[i].ID = 0
+		rows[i].RecordedAt = time.Time{}
+	}
+	body, err := json.Marshal(rows)
+	if err != nil {
+		return nil, fmt.Errorf("encode spill entry: %w", err)
+	}
+
+	line := make([]byte, 0, len(body)+10)
+	line = hex.AppendEncode(line, crc32Bytes(body))
+	line = append(line, ' ')
+	line = append(line, body...)
+	return append(line, '\n'), nil
+}
+
+func decodeSpillEntry(line []byte) ([]*KlineRecord, error) {
+	sum, body, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !ok || string(sum) != hex.EncodeToString(crc32Bytes(body)) {
+		return nil, errors.New("spill entry checksum mismatch")
+	}
+	var rows []KlineRecord
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("decode spill entry: %w", err)
+	}
+	records := make([]*KlineRecord, len(rows))
+	for i := range rows {
+		records[i] = &rows[i]
+	}
+	return records, nil
+}
+
+func crc32Bytes(b []byte) []byte {
+	return binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(b))
+}
@@ -0,0 +1,141 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"wscollector/pkg/decimal"
+	"wscollector/pkg/storage/postgres"
+)
+
+func spillRecord(minute int) *postgres.KlineRecord {
+	start := time.Date(2026, 1, 1, 0, minute, 0, 0, time.UTC)
+	return &postgres.KlineRecord{
+		ID:        uint(minute + 1),
+		Symbol:    "SPILLUSDT",
+		Interval:  "1m",
+		PriceType: "last",
+		Start:     start,
+		End:       start.Add(time.Minute - time.Millisecond),
+		Open:      decimal.MustParse("1.10"),
+		Close:     decimal.MustParse("1.20"),
+		High:      decimal.MustParse("1.30"),
+		Low:       decimal.MustParse("1.00"),
+		Volume:    decimal.MustParse("5"),
+		Turnover:  decimal.MustParse("6"),
+		Confirm:   true,
+		Timestamp: start.Add(time.Minute),
+	}
+}
+
+// go test -v --run TestKlineSpillReplay
+func TestKlineSpillReplay(t *testing.T) {
+	dir := t.TempDir()
+	spill, err := postgres.OpenKlineSpill(postgres.KlineSpillConfig{Dir: dir, SegmentBytes: 1})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := spill.Append([]*postgres.KlineRecord{spillRecord(i)}); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+	spill.Close()
+
+	// Segments survive a restart; one entry per segment as SegmentBytes is tiny
+	spill, err = postgres.OpenKlineSpill(postgres.KlineSpillConfig{Dir: dir, SegmentBytes: 1})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer spill.Close()
+	if stats := spill.Stats(); stats.Segments != 4 || !spill.Pending() {
+		t.Fatalf("unexpected stats after reopen: %+v", stats)
+	}
+
+	var written []time.Time
+	down := true
+	write := func(_ context.Context, records []*postgres.KlineRecord) error {
+		if down && len(written) == 2 {
+			return errors.New("connection refused")
+		}
+		for _, r := range records {
+			if r.ID != 0 {
+				t.Errorf("replayed record kept id %d", r.ID)
+			}
+			written = append(written, r.Start)
+		}
+		return nil
+	}
+
+	n, err := spill.Replay(context.Background(), 1, write)
+	if err == nil || n != 2 {
+		t.Fatalf("first replay wrote %d, err %v; want 2 and an error", n, err)
+	}
+
+	down = false
+	n, err = spill.Replay(context.Background(), 1, write)
+	if err != nil || n != 2 {
+		t.Fatalf("second replay wrote %d, err %v; want 2", n, err)
+	}
+	for i, start := range written {
+		if !start.Equal(spillRecord(i).Start) {
+			t.Errorf("replayed kline %d starts at %s", i, start)
+		}
+	}
+
+	stats := spill.Stats()
+	if spill.Pending() || stats.Bytes != 0 || stats.Replayed != 4 {
+		t.Errorf("unexpected stats after replay: %+v", stats)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.spill")); len(files) > 1 {
+		t.Errorf("replayed segments left on disk: %v", files)
+	}
+}
+
+// go test -v --run TestKlineSpillLimits
+func TestKlineSpillLimits(t *testing.T) {
+	dir := t.TempDir()
+	spill, err := postgres.OpenKlineSpill(postgres.KlineSpillConfig{Dir: dir, MaxBytes: 1000})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if err := spill.Append([]*postgres.KlineRecord{spillRecord(0)}); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	batch := []*postgres.KlineRecord{spillRecord(1), spillRecord(2), spillRecord(3)}
+	if err := spill.Append(batch); !errors.Is(err, postgres.ErrSpillFull) {
+		t.Fatalf("expected ErrSpillFull, got %v", err)
+	}
+	spill.Close()
+
+	// A crash mid-append leaves a torn last line, which replay skips
+	files, _ := filepath.Glob(filepath.Join(dir, "*.spill"))
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("open segment failed: %v", err)
+	}
+	f.WriteString(`0badc0de [{"Symbol":"SPI`)
+	f.Close()
+
+	spill, err = postgres.OpenKlineSpill(postgres.KlineSpillConfig{Dir: dir, MaxBytes: 1000})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer spill.Close()
+
+	var written []*postgres.KlineRecord
+	n, err := spill.Replay(context.Background(), 0, func(_ context.Context, records []*postgres.KlineRecord) error {
+		written = append(written, records...)
+		return nil
+	})
+	if err != nil || n != 1 || written[0].Close.String() != "1.20" {
+		t.Fatalf("replay wrote %d (%v), err %v", n, written, err)
+	}
+	if stats := spill.Stats(); stats.Rejected != 0 || stats.Corrupt != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"wscollector/config"
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/decimal"
 	"wscollector/pkg/storage/postgres"
 )
 
@@ -29,7 +31,7 @@ func TestKlineCRUD(t *testing.T) {
 
 	ctx := context.Background()
 
-	if err := client.AutoMigrateKlineRecord(); err != nil {
+	if _, err := client.MigrateUp(ctx); err != nil {
 		t.Fatalf("failed to migrate: %v", err)
 	}
 
@@ -40,17 +42,17 @@ func TestKlineCRUD(t *testing.T) {
 		Interval:  "1h",
 		Start:     now,
 		End:       now.Add(time.Minute),
-		Open:      31400.0,
-		Close:     31500.0,
-		High:      31600.0,
-		Low:       31300.0,
-		Volume:    123.45,
-		Turnover:  3890000.0,
+		Open:      decimal.MustParse("31400.0"),
+		Close:     decimal.MustParse("31500.0"),
+		High:      decimal.MustParse("31600.0"),
+		Low:       decimal.MustParse("31300.0"),
+		Volume:    decimal.MustParse("123.45"),
+		Turnover:  decimal.MustParse("3890000.0"),
 		Confirm:   true,
 		Timestamp: time.Now(),
 	}
 
-	if err := client.InsertKline(ctx, record); err != nil {
+	if _, err := client.InsertKline(ctx, record); err != nil {
 		t.Fatalf("insert failed: %v", err)
 	}
 
@@ -59,7 +61,7 @@ func TestKlineCRUD(t *testing.T) {
 	if err != nil {
 		t.Fatalf("get failed: %v", err)
 	}
-	if got.Symbol != "BTCUSDT" || got.Open != 31400.0 {
+	if got.Symbol != "BTCUSDT" || got.Open.String() != "31400.0" {
 		t.Errorf("unexpected kline values: %+v", got)
 	}
 
@@ -88,3 +90,414 @@ func TestKlineCRUD(t *testing.T) {
 		t.Error("expected error after delete, got nil")
 	}
 }
+
+// go test -v --run TestGetKlineRange
+func TestGetKlineRange(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	base := time.Now().Truncate(time.Minute).Add(-time.Hour)
+	for i := 0; i < 3; i++ {
+		start := base.Add(time.Duration(i) * time.Minute)
+		record := &postgres.KlineRecord{
+			Symbol:    "RANGEUSDT",
+			Interval:  "1m",
+			PriceType: "last",
+			Start:     start,
+			End:       start.Add(time.Minute - time.Millisecond),
+			Open:      decimal.MustParse("1.0"),
+			Close:     decimal.MustParse("1.1"),
+			High:      decimal.MustParse("1.2"),
+			Low:       decimal.MustParse("0.9"),
+			Volume:    decimal.MustParse("10"),
+			Turnover:  decimal.MustParse("11"),
+			Confirm:   true,
+			Timestamp: time.Now(),
+		}
+		if _, err := client.InsertKline(ctx, record); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	defer client.DeleteOldKlines(ctx, time.Now())
+
+	got, err := client.GetKlineRange(ctx, []string{"RANGEUSDT"}, "1m", base.Add(time.Minute), base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("range read failed: %v", err)
+	}
+	if len(got) != 2 || !got[0].Start.Equal(base.Add(time.Minute)) {
+		t.Errorf("unexpected range result: %+v", got)
+	}
+}
+
+// go test -v --run TestKlineWriter
+func TestKlineWriter(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.MigrateUp(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	var results []postgres.BatchResult
+	writer := client.NewKlineWriter(postgres.KlineWriterConfig{
+		BatchSize: 2,
+		OnBatch:   func(r postgres.BatchResult) { results = append(results, r) },
+	})
+
+	base := time.Now().Truncate(time.Minute).Add(-2 * time.Hour)
+	record := func(i int) *postgres.KlineRecord {
+		start := base.Add(time.Duration(i) * time.Minute)
+		return &postgres.KlineRecord{
+			Symbol:    "WRITERUSDT",
+			Interval:  "1m",
+			PriceType: "last",
+			Start:     start,
+			End:       start.Add(time.Minute - time.Millisecond),
+			Open:      decimal.MustParse("1"),
+			Close:     decimal.MustParse("1"),
+			High:      decimal.MustParse("1"),
+			Low:       decimal.MustParse("1"),
+			Volume:    decimal.MustParse("1"),
+			Turnover:  decimal.MustParse("1"),
+			Confirm:   true,
+			Timestamp: time.Now(),
+		}
+	}
+
+	// Rows 0 and 1 form the first batch; row 0 again, then row 2 form the second
+	for _, i := range []int{0, 1, 0, 2} {
+		if err := writer.Write(record(i)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	writer.Close()
+	defer client.DeleteOldKlines(context.Background(), time.Now())
+
+	if err := writer.Write(record(3)); err == nil {
+		t.Error("expected write after close to fail")
+	}
+
+	stats := writer.Stats()
+	if stats.Rows != 4 || stats.Inserted != 3 || stats.Duplicates != 1 || stats.Failed != 0 {
+		t.Errorf("unexpected writer stats: %+v (batches %+v)", stats, results)
+	}
+}
+
+// go test -v --run TestKlineQueries
+func TestKlineQueries(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	// QUERYAUSDT has five confirmed minutes, QUERYBUSDT only the first two
+	base := time.Now().Truncate(time.Minute).Add(-3 * time.Hour)
+	for symbol, count := range map[string]int{"QUERYAUSDT": 5, "QUERYBUSDT": 2} {
+		for i := 0; i < count; i++ {
+			start := base.Add(time.Duration(i) * time.Minute)
+			record := &postgres.KlineRecord{
+				Symbol:    symbol,
+				Interval:  "1m",
+				PriceType: "last",
+				Start:     start,
+				End:       start.Add(time.Minute - time.Millisecond),
+				Open:      decimal.MustParse("1"),
+				Close:     decimal.MustParse("1"),
+				High:      decimal.MustParse("1"),
+				Low:       decimal.MustParse("1"),
+				Volume:    decimal.MustParse("1"),
+				Turnover:  decimal.MustParse("1"),
+				Confirm:   true,
+				Timestamp: time.Now(),
+			}
+			if _, err := client.InsertKline(ctx, record); err != nil {
+				t.Fatalf("insert failed: %v", err)
+			}
+		}
+	}
+	defer client.DeleteOldKlines(ctx, time.Now())
+
+	got, err := client.QueryKlines(ctx, postgres.KlineQuery{
+		Symbol: "QUERYAUSDT", Interval: "1m", From: base.Add(time.Minute), Limit: 2, Desc: true,
+	})
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(got) != 2 || !got[0].Start.Equal(base.Add(4*time.Minute)) || !got[1].Start.Equal(base.Add(3*time.Minute)) {
+		t.Errorf("unexpected query result: %+v", got)
+	}
+
+	latest, err := client.LatestKlines(ctx, []string{"QUERYAUSDT", "QUERYBUSDT", "QUERYCUSDT"}, "1m", "")
+	if err != nil {
+		t.Fatalf("latest failed: %v", err)
+	}
+	if len(latest) != 2 || !latest["QUERYAUSDT"].Start.Equal(base.Add(4*time.Minute)) ||
+		!latest["QUERYBUSDT"].Start.Equal(base.Add(time.Minute)) {
+		t.Errorf("unexpected latest klines: %+v", latest)
+	}
+
+	// At minute 3 only QUERYAUSDT has a candle; QUERYBUSDT's last one ended before
+	at := base.Add(3*time.Minute + 30*time.Second)
+	section, err := client.KlineCrossSection(ctx, []string{"QUERYAUSDT", "QUERYBUSDT"}, "1m", "last", at)
+	if err != nil {
+		t.Fatalf("cross-section failed: %v", err)
+	}
+	if len(section) != 1 || section[0].Symbol != "QUERYAUSDT" || !section[0].Start.Equal(base.Add(3*time.Minute)) {
+		t.Errorf("unexpected cross-section: %+v", section)
+	}
+
+	cursor := client.StreamKlines(ctx, postgres.KlineQuery{Symbol: "QUERYAUSDT", Interval: "1m", Limit: 4}, 3)
+	var streamed []time.Time
+	for cursor.Next() {
+		streamed = append(streamed, cursor.Kline().Start)
+	}
+	if err := cursor.Err(); err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if len(streamed) != 4 {
+		t.Fatalf("streamed %d klines, want 4", len(streamed))
+	}
+	for i, start := range streamed {
+		if !start.Equal(base.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("streamed kline %d starts at %s", i, start)
+		}
+	}
+}
+
+// go test -v --run TestInsertKlineOutcomes
+func TestInsertKlineOutcomes(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	start := time.Now().Truncate(time.Minute).Add(-4 * time.Hour)
+	record := func(close string) *postgres.KlineRecord {
+		return &postgres.KlineRecord{
+			Symbol:    "OUTCOMEUSDT",
+			Interval:  "1m",
+			PriceType: "last",
+			Start:     start,
+			End:       start.Add(time.Minute - time.Millisecond),
+			Open:      decimal.MustParse("1"),
+			Close:     decimal.MustParse(close),
+			High:      decimal.MustParse("2"),
+			Low:       decimal.MustParse("1"),
+			Volume:    decimal.MustParse("1"),
+			Turnover:  decimal.MustParse("1"),
+			Confirm:   true,
+			Timestamp: time.Now(),
+		}
+	}
+	defer client.DeleteOldKlines(ctx, time.Now())
+	defer client.DB.Where("symbol = ?", "OUTCOMEUSDT").Delete(&postgres.KlineRevision{})
+
+	steps := []struct {
+		policy postgres.ConflictPolicy
+		close  string
+		want   postgres.KlineOutcome
+		stored string
+	}{
+		{postgres.ConflictKeep, "1.5", postgres.KlineInserted, "1.5"},
+		{postgres.ConflictKeep, "1.50", postgres.KlineDuplicate, "1.5"},
+		{postgres.ConflictKeep, "1.6", postgres.KlineConflict, "1.5"},
+		{postgres.ConflictRevision, "1.7", postgres.KlineConflict, "1.5"},
+		{postgres.ConflictOverwrite, "1.8", postgres.KlineConflict, "1.8"},
+	}
+	for i, step := range steps {
+		client.SetConflictPolicy(step.policy)
+		got, err := client.InsertKline(ctx, record(step.close))
+		if err != nil {
+			t.Fatalf("step %d: insert failed: %v", i, err)
+		}
+		if got != step.want {
+			t.Errorf("step %d: outcome %s, want %s", i, got, step.want)
+		}
+		stored, err := client.GetKline(ctx, "OUTCOMEUSDT", "1m", start)
+		if err != nil {
+			t.Fatalf("step %d: get failed: %v", i, err)
+		}
+		if stored.Close.String() != step.stored {
+			t.Errorf("step %d: stored close %s, want %s", i, stored.Close, step.stored)
+		}
+	}
+
+	var revisions []postgres.KlineRevision
+	if err := client.DB.Where("symbol = ?", "OUTCOMEUSDT").Find(&revisions).Error; err != nil {
+		t.Fatalf("read revisions failed: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Close.String() != "1.7" {
+		t.Errorf("unexpected revisions: %+v", revisions)
+	}
+}
+
+// go test -v --run TestKlineWriterReplaysSpill
+func TestKlineWriterReplaysSpill(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	base := time.Now().Truncate(time.Minute).Add(-5 * time.Hour)
+	record := func(i int, interval string) *postgres.KlineRecord {
+		start := base.Add(time.Duration(i) * time.Minute)
+		return &postgres.KlineRecord{
+			Symbol:    "REPLAYUSDT",
+			Interval:  interval,
+			PriceType: "last",
+			Start:     start,
+			End:       start.Add(time.Minute - time.Millisecond),
+			Open:      decimal.MustParse("1"),
+			Close:     decimal.MustParse("1"),
+			High:      decimal.MustParse("1"),
+			Low:       decimal.MustParse("1"),
+			Volume:    decimal.MustParse("1"),
+			Turnover:  decimal.MustParse("1"),
+			Confirm:   true,
+			Timestamp: time.Now(),
+		}
+	}
+	defer client.DeleteOldKlines(ctx, time.Now())
+
+	// Rows spilled during an outage, with a batch Postgres will always reject in between
+	spill, err := postgres.OpenKlineSpill(postgres.KlineSpillConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open spill failed: %v", err)
+	}
+	defer spill.Close()
+	for _, batch := range [][]*postgres.KlineRecord{
+		{record(0, "1m"), record(1, "1m")},
+		{record(2, "not-an-interval")},
+		{record(3, "1m")},
+	} {
+		if err := spill.Append(batch); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+	}
+
+	writer := client.NewKlineWriter(postgres.KlineWriterConfig{
+		BatchSize:   1,
+		Spill:       spill,
+		ReplayEvery: 10 * time.Millisecond,
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for spill.Pending() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Once drained, new rows go straight to Postgres
+	if err := writer.Write(record(4, "1m")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	writer.Close()
+
+	if stats := spill.Stats(); stats.Replayed != 3 || stats.Quarantined != 1 || stats.Bytes != 0 {
+		t.Errorf("unexpected spill stats: %+v", stats)
+	}
+	if stats := writer.Stats(); stats.Spilled != 0 || stats.Inserted != 4 {
+		t.Errorf("unexpected writer stats: %+v", stats)
+	}
+
+	got, err := client.GetKlineRange(ctx, []string{"REPLAYUSDT"}, "1m", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("range read failed: %v", err)
+	}
+	if len(got) != 4 {
+		t.Errorf("found %d replayed klines, want 4", len(got))
+	}
+}
+
+// go test -v --run TestToKlineRecordMissingField
+func TestToKlineRecordMissingField(t *testing.T) {
+	// Several fields are missing; the first in column order is reported every time
+	k := memorystore.Kline{Start: 60000, Interval: "1m", Open: decimal.MustParse("1"), High: decimal.MustParse("1")}
+	for range 20 {
+		_, err := postgres.ToKlineRecord("BTCUSDT", k)
+		if err == nil || err.Error() != "kline BTCUSDT 60000 missing close" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxKlineBatch keeps a multi-row INSERT under Postgres' 65535 bind-parameter limit.
+const maxKlineBatch = 4000
+
+// ErrWriterClosed is returned by KlineWriter.Write after Close.
+var ErrWriterClosed = errors.New("kline writer closed")
+
+// KlineWriterConfig tunes a KlineWriter. Zero values use the defaults noted per field.
+type KlineWriterConfig struct {
+	BatchSize     int               // rows per INSERT (default 500, at most 4000)
+	FlushInterval time.Duration     // longest time a row waits before its batch is written (default 1s)
+	QueueSize     int               // rows buffered before Write blocks, or spills if Spill is set (default 10000)
+	Timeout       time.Duration     // statement timeout per batch (default 10s)
+	OnBatch       func(BatchResult) // called after every batch, e.g. for logging; may be nil
+
+	// Spill keeps batches on disk while Postgres is unreachable and until it recovers; may
+	// be nil, in which case those batches are lost. The writer replays but does not close it.
+	Spill       *KlineSpill
+	ReplayEvery time.Duration      // how often a pending spill is retried (default 5s)
+	OnReplay    func(ReplayResult) // called after every replay that wrote rows or failed; may be nil
+}
+
+// BatchResult reports the outcome of one batch write.
+type BatchResult struct {
+	Rows       int // rows received for the batch
+	Inserted   int // rows inserted, or forming rows confirmed
+	Duplicates int // rows already confirmed with the same values, or replaced by a later row in the batch
+	Conflicts  int // rows already confirmed with different values, resolved by the client's ConflictPolicy
+	Spilled    int // rows appended to the spill instead, to be replayed later
+	Took       time.Duration
+	Err        error // non-nil if the batch failed; its rows were written to the spill if Spilled is set, else lost
+}
+
+// ReplayResult reports one pass of draining the spill into Postgres.
+type ReplayResult struct {
+	Rows        int // rows written back
+	Quarantined int // rows Postgres rejected, moved to the spill's quarantine file
+	Took        time.Duration
+	Err         error // non-nil if the pass stopped early; the rest is retried later
+}
+
+// KlineWriterStats are cumulative counters since the writer started.
+type KlineWriterStats struct {
+	Batches    int64
+	Rows       int64
+	Inserted   int64
+	Duplicates int64
+	Conflicts  int64
+	Spilled    int64 // rows appended to the spill
+	Failed     int64 // rows lost in failed batches
+}
+
+// KlineWriter buffers confirmed klines and writes them in multi-row
+// INSERT ... ON CONFLICT statements, grouping rows by count or time.
+type KlineWriter struct {
+	client *PostgresClient
+	cfg    KlineWriterConfig
+
+	mu     sync.RWMutex // guards closed against concurrent Write
+	closed bool
+	in     chan *KlineRecord
+	flush  chan chan struct{}
+	done   chan struct{}
+
+	batches    atomic.Int64
+	rows       atomic.Int64
+	inserted   atomic.Int64
+	duplicates atomic.Int64
+	conflicts  atomic.Int64
+	spilled    atomic.Int64
+	failed     atomic.Int64
+
+	overflow   atomic.Bool // Write found the queue full; the next batch goes to the spill
+	stopReplay context.CancelFunc
+	replayDone chan struct{}
+
+	errMu   sync.Mutex
+	lastErr error // error of the most recent batch
+}
+
+// NewKlineWriter starts a batching writer. Close must be called to write buffered rows.
+func (p *PostgresClient) NewKlineWriter(cfg KlineWriterConfig) *KlineWriter {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	cfg.BatchSize = min(cfg.BatchSize, maxKlineBatch)
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	if cfg.ReplayEvery <= 0 {
+		cfg.ReplayEvery = 5 * time.Second
+	}
+
+	w := &KlineWriter{
+		client:     p,
+		cfg:        cfg,
+		in:         make(chan *KlineRecord, cfg.QueueSize),
+		flush:      make(chan chan struct{}),
+		done:       make(chan struct{}),
+		replayDone: make(chan struct{}),
+	}
+	go w.run()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.stopReplay = cancel
+	if cfg.Spill != nil {
+		go w.replay(ctx)
+	} else {
+		close(w.replayDone)
+	}
+	return w
+}
+
+// Write queues a record and fails after Close. It blocks while the queue is full; with a
+// spill, queued batches then go to disk instead of waiting on the database, so the wait
+// is at most the batch in flight and rows still reach Postgres in order.
+func (w *KlineWriter) Write(record *KlineRecord) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	if w.cfg.Spill != nil {
+		select {
+		case w.in <- record:
+			return nil
+		default:
+			w.overflow.Store(true)
+		}
+	}
+	w.in <- record
+	return nil
+}
+
+// Flush writes every queued row and returns once they are written.
+func (w *KlineWriter) Flush() {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return
+	}
+	ack := make(chan struct{})
+	w.flush <- ack
+	w.mu.RUnlock()
+	<-ack
+}
+
+// Close stops accepting rows, writes everything queued and waits for the last batch.
+// Rows still in the spill stay there for the next run.
+func (w *KlineWriter) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.in)
+	}
+	w.mu.Unlock()
+	<-w.done
+
+	w.stopReplay()
+	<-w.replayDone
+}
+
+// Stats returns the cumulative batch counters.
+func (w *KlineWriter) Stats() KlineWriterStats {
+	return KlineWriterStats{
+		Batches:    w.batches.Load(),
+		Rows:       w.rows.Load(),
+		Inserted:   w.inserted.Load(),
+		Duplicates: w.duplicates.Load(),
+		Conflicts:  w.conflicts.Load(),
+		Spilled:    w.spilled.Load(),
+		Failed:     w.failed.Load(),
+	}
+}
+
+// LastError returns the error of the most recent batch, or nil if it succeeded. With a
+// spill it stays set until the spill is drained.
+func (w *KlineWriter) LastError() error {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return w.lastErr
+}
+
+func (w *KlineWriter) setLastError(err error) {
+	w.errMu.Lock()
+	w.lastErr = err
+	w.errMu.Unlock()
+}
+
+func (w *KlineWriter) run() {
+	defer close(w.done)
+
+	batch := make([]*KlineRecord, 0, w.cfg.BatchSize)
+	timer := time.NewTimer(w.cfg.FlushInterval)
+	timer.Stop()
+
+	write := func() {
+		timer.Stop()
+		if len(batch) > 0 {
+			w.writeBatch(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case record, ok := <-w.in:
+			if !ok {
+				write()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(w.cfg.FlushInterval)
+			}
+			batch = append(batch, record)
+			if len(batch) >= w.cfg.BatchSize {
+				write()
+			}
+
+		case <-timer.C:
+			write()
+
+		case ack := <-w.flush:
+			// Drain what was queued before the flush request
+			for pending := len(w.in); pending > 0; pending-- {
+				batch = append(batch, <-w.in)
+				if len(batch) >= w.cfg.BatchSize {
+					write()
+				}
+			}
+			write()
+			close(ack)
+		}
+	}
+}
+
+func (w *KlineWriter) writeBatch(batch []*KlineRecord) {
+	began := time.Now()
+	unique := dedupeKlines(batch)
+	result := BatchResult{Rows: len(batch)}
+
+	// Rows already in the spill go first, so later batches queue behind them. Only this
+	// goroutine appends to the spill, so a drained spill stays drained until it spills again.
+	spill := w.cfg.Spill
+	toSpill := spill != nil && (w.overflow.Swap(false) || spill.Pending())
+
+	var outcomes []KlineOutcome
+	if !toSpill {
+		ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Timeout)
+		outcomes, result.Err = w.client.InsertKlines(ctx, unique)
+		cancel()
+		w.setLastError(result.Err)
+
+		// A batch Postgres rejects would fail again on replay, so only outages are spilled
+		toSpill = result.Err != nil && spill != nil && w.unavailable(context.Background(), result.Err)
+	}
+	if toSpill {
+		if err := spill.Append(unique); err != nil {
+			result.Err = errors.Join(result.Err, err)
+		} else {
+			result.Spilled = len(unique)
+		}
+	}
+
+	w.batches.Add(1)
+	w.rows.Add(int64(len(batch)))
+	switch {
+	case result.Spilled > 0:
+		result.Duplicates = len(batch) - result.Spilled
+		w.spilled.Add(int64(result.Spilled))
+		w.duplicates.Add(int64(result.Duplicates))
+	case result.Err != nil:
+		w.failed.Add(int64(len(batch)))
+	default:
+		result.Inserted, result.Conflicts = w.countOutcomes(outcomes)
+		result.Duplicates = len(batch) - result.Inserted - result.Conflicts
+		w.duplicates.Add(int64(result.Duplicates))
+	}
+	result.Took = time.Since(began)
+
+	if w.cfg.OnBatch != nil {
+		w.cfg.OnBatch(result)
+	}
+}
+
+// countOutcomes adds inserted and conflicting rows to the writer's counters and returns
+// them. Duplicates are left to the caller, which also counts rows deduplicated in a batch.
+func (w *KlineWriter) countOutcomes(outcomes []KlineOutcome) (inserted, conflicts int) {
+	for _, outcome := range outcomes {
+		switch outcome {
+		case KlineInserted:
+			inserted++
+		case KlineConflict:
+			conflicts++
+		}
+	}
+	w.inserted.Add(int64(inserted))
+	w.conflicts.Add(int64(conflicts))
+	return inserted, conflicts
+}
+
+// replay drains the spill whenever Postgres answers again, until ctx is cancelled.
+func (w *KlineWriter) replay(ctx context.Context) {
+	defer close(w.replayDone)
+
+	ticker := time.NewTicker(w.cfg.ReplayEvery)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if !w.cfg.Spill.Pending() {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+		healthy := w.client.IsHealthy(pingCtx)
+		cancel()
+		if !healthy {
+			continue
+		}
+
+		began := time.Now()
+		quarantined := w.cfg.Spill.Stats().Quarantined
+		rows, err := w.cfg.Spill.Replay(ctx, w.cfg.BatchSize, w.replayBatch)
+		if err == nil {
+			w.setLastError(nil)
+		}
+		result := ReplayResult{
+			Rows:        rows,
+			Quarantined: int(w.cfg.Spill.Stats().Quarantined - quarantined),
+			Took:        time.Since(began),
+			Err:         err,
+		}
+		if w.cfg.OnReplay != nil && (result.Rows > 0 || result.Quarantined > 0 || err != nil) {
+			w.cfg.OnReplay(result)
+		}
+	}
+}
+
+// replayBatch writes one batch read back from the spill. A batch Postgres rejects while it
+// is available is quarantined so it does not block the rows behind it.
+func (w *KlineWriter) replayBatch(ctx context.Context, records []*KlineRecord) error {
+	insertCtx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+
+	outcomes, err := w.client.InsertKlines(insertCtx, records)
+	if err != nil {
+		if w.unavailable(ctx, err) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrRejectBatch, err)
+	}
+	inserted, conflicts := w.countOutcomes(outcomes)
+	w.duplicates.Add(int64(len(records) - inserted - conflicts))
+	return nil
+}
+
+// unavailable reports whether a failed write means the database could not be reached,
+// rather than that it rejected the rows.
+func (w *KlineWriter) unavailable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || isUnavailable(err) {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+	defer cancel()
+	return !w.client.IsHealthy(ctx)
+}
+
+// isUnavailable reports whether err is a connection or availability error: the network,
+// a timeout, or a server that is shutting down, starting or out of resources.
+func isUnavailable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 connection exception, 53 insufficient resources, 57 operator intervention
+		// (including statement timeouts), 58 system error
+		return slices.Contains([]string{"08", "53", "57", "58"}, pgErr.Code[:min(2, len(pgErr.Code))])
+	}
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.As(err, &netErr) || errors.As(err, &connectErr) ||
+		pgconn.Timeout(err) || pgconn.SafeToRetry(err)
+}
+
+// InsertKlines stores confirmed klines with the same handling as InsertKline and returns
+// the outcome of each record, in order. New candles go out in one multi-row statement.
+// Records must be unique by (symbol, interval, price_type, start).
+//
+// Outcomes are decided from the rows read at the start of the transaction; a candle confirmed
+// by another writer in the meantime is left untouched but still reported as inserted.
+func (p *PostgresClient) InsertKlines(ctx context.Context, records []*KlineRecord) ([]KlineOutcome, error) {
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	outcomes := make([]KlineOutcome, len(records))
+	err := p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := confirmedKlines(tx, records)
+		if err != nil {
+			return err
+		}
+
+		var fresh, conflicts []*KlineRecord
+		for i, r := range records {
+			row, ok := stored[keyOf(r)]
+			switch {
+			case !ok:
+				outcomes[i] = KlineInserted
+				fresh = append(fresh, r)
+			case !r.Confirm || sameKlineValues(&row, r):
+				outcomes[i] = KlineDuplicate
+			default:
+				outcomes[i] = KlineConflict
+				conflicts = append(conflicts, r)
+			}
+		}
+
+		if len(fresh) > 0 {
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   klineConflictColumns,
+				DoUpdates: clause.AssignmentColumns(klineValueColumns),
+				Where:     formingRowOnly(),
+			}).CreateInBatches(fresh, maxKlineBatch).Error
+			if err != nil {
+				return err
+			}
+		}
+		return p.resolveConflicts(tx, conflicts)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch insert klines: %w", err)
+	}
+	return outcomes, nil
+}
+
+// dedupeKlines keeps the last record per unique key, in first-seen order. Postgres rejects
+// an INSERT ... ON CONFLICT DO UPDATE that touches the same row twice.
+func dedupeKlines(records []*KlineRecord) []*KlineRecord {
+	index := make(map[klineKey]int, len(records))
+	out := make([]*KlineRecord, 0, len(records))
+	for _, r := range records {
+		k := keyOf(r)
+		if i, ok := index[k]; ok {
+			out[i] = r
+			continue
+		}
+		index[k] = len(out)
+		out = append(out, r)
+	}
+	return out
+}
@@ -0,0 +1,150 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"wscollector/pkg/decimal"
+
+	pg "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// unreachableClient returns a client whose database refuses every connection.
+func unreachableClient(t *testing.T) *PostgresClient {
+	db, err := gorm.Open(pg.Open("host=127.0.0.1 port=1 user=postgres dbname=wscollector sslmode=disable connect_timeout=1"),
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to open client: %v", err)
+	}
+	return &PostgresClient{DB: db}
+}
+
+func writerRecord(minute int) *KlineRecord {
+	start := time.Date(2026, 1, 1, 0, minute, 0, 0, time.UTC)
+	return &KlineRecord{
+		Symbol:    "WRITERSPILLUSDT",
+		Interval:  "1m",
+		PriceType: "last",
+		Start:     start,
+		End:       start.Add(time.Minute - time.Millisecond),
+		Open:      decimal.MustParse("1"),
+		Close:     decimal.MustParse("1"),
+		High:      decimal.MustParse("1"),
+		Low:       decimal.MustParse("1"),
+		Volume:    decimal.MustParse("1"),
+		Turnover:  decimal.MustParse("1"),
+		Confirm:   true,
+		Timestamp: start.Add(time.Minute),
+	}
+}
+
+// go test -v --run TestKlineWriterSpillsDuringOutage
+func TestKlineWriterSpillsDuringOutage(t *testing.T) {
+	spill, err := OpenKlineSpill(KlineSpillConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open spill failed: %v", err)
+	}
+	defer spill.Close()
+
+	writer := unreachableClient(t).NewKlineWriter(KlineWriterConfig{
+		BatchSize:     2,
+		FlushInterval: 10 * time.Millisecond,
+		Timeout:       time.Second,
+		Spill:         spill,
+		ReplayEvery:   10 * time.Millisecond,
+	})
+	// The first batch fails on the database; the rest queue behind it in the spill
+	for i := 0; i < 7; i++ {
+		if err := writer.Write(writerRecord(i)); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+		if i == 1 {
+			writer.Flush()
+		}
+	}
+	writer.Close()
+
+	stats := writer.Stats()
+	if stats.Spilled != 7 || stats.Failed != 0 || stats.Inserted != 0 {
+		t.Errorf("unexpected writer stats: %+v", stats)
+	}
+	if writer.LastError() == nil || !isUnavailable(writer.LastError()) {
+		t.Errorf("expected the connection error as the last error, got %v", writer.LastError())
+	}
+	if !spill.Pending() {
+		t.Fatal("expected spilled rows to stay pending while the database is down")
+	}
+
+	// The spill holds the rows in the order they were written
+	var starts []time.Time
+	_, err = spill.Replay(context.Background(), 0, func(_ context.Context, records []*KlineRecord) error {
+		for _, r := range records {
+			starts = append(starts, r.Start)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if len(starts) != 7 {
+		t.Fatalf("replayed %d rows, want 7", len(starts))
+	}
+	for i, start := range starts {
+		if !start.Equal(writerRecord(i).Start) {
+			t.Errorf("spilled row %d starts at %s", i, start)
+		}
+	}
+}
+
+// go test -v --run TestIsUnavailable
+func TestIsUnavailable(t *testing.T) {
+	_, err := unreachableClient(t).InsertKlines(context.Background(), []*KlineRecord{writerRecord(0)})
+	if err == nil || !isUnavailable(err) {
+		t.Errorf("connection error %v not classified as unavailable", err)
+	}
+	if isUnavailable(context.Canceled) {
+		t.Error("cancellation classified as unavailable")
+	}
+}
+
+// go test -v --run TestKlineWriterOverflowKeepsOrder
+func TestKlineWriterOverflowKeepsOrder(t *testing.T) {
+	spill, err := OpenKlineSpill(KlineSpillConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("open spill failed: %v", err)
+	}
+	defer spill.Close()
+
+	// With a queue of one, Write finds it full and queued rows go to the spill
+	writer := unreachableClient(t).NewKlineWriter(KlineWriterConfig{
+		BatchSize:     3,
+		FlushInterval: 10 * time.Millisecond,
+		QueueSize:     1,
+		Spill:         spill,
+	})
+	for i := 0; i < 20; i++ {
+		if err := writer.Write(writerRecord(i)); err != nil {
+			t.Fatalf("write %d failed: %v", i, err)
+		}
+	}
+	writer.Close()
+
+	if stats := writer.Stats(); stats.Spilled != 20 || stats.Failed != 0 {
+		t.Errorf("unexpected writer stats: %+v", stats)
+	}
+	var starts []time.Time
+	spill.Replay(context.Background(), 0, func(_ context.Context, records []*KlineRecord) error {
+		for _, r := range records {
+			starts = append(starts, r.Start)
+		}
+		return nil
+	})
+	for i, start := range starts {
+		if !start.Equal(writerRecord(i).Start) {
+			t.Fatalf("spilled row %d starts at %s", i, start)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package postgres
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey serializes migrations between collectors sharing a database.
+const migrationLockKey = 7_406_116_011
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrPendingMigrations is returned by CheckSchema when the database is behind the binary.
+var ErrPendingMigrations = errors.New("schema migrations pending")
+
+// Migration is one versioned schema change, embedded from migrations/NNNN_name.{up,down}.sql.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration is applied to the database.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    bigint PRIMARY KEY,
+    name       text        NOT NULL,
+    applied_at timestamptz NOT NULL
+)`
+
+// schemaMigration is a row of schema_migrations, one per applied version.
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:text;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrations returns the embedded migrations ordered by version.
+func Migrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+// LatestMigration returns the highest embedded migration version.
+func LatestMigration() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// MigrationStatus lists every embedded migration and whether it is applied.
+func (p *PostgresClient) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := p.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Migration: m}
+		if row, ok := applied[m.Version]; ok {
+			states[i].Applied = true
+			states[i].AppliedAt = row.AppliedAt
+		}
+	}
+	return states, nil
+}
+
+// SchemaVersion returns the highest applied migration version, or 0 for an empty database.
+func (p *PostgresClient) SchemaVersion(ctx context.Context) (int, error) {
+	applied, err := p.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// CheckSchema returns ErrPendingMigrations if any embedded migration is not applied.
+// It is used instead of MigrateUp when auto-migration is disabled.
+func (p *PostgresClient) CheckSchema(ctx context.Context) error {
+	states, err := p.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, s := range states {
+		if !s.Applied {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %v", ErrPendingMigrations, pending)
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration and returns how many were applied.
+func (p *PostgresClient) MigrateUp(ctx context.Context) (int, error) {
+	latest, err := LatestMigration()
+	if err != nil {
+		return 0, err
+	}
+	return p.MigrateTo(ctx, latest)
+}
+
+// MigrateDown reverts the most recent steps applied migrations and returns how many were reverted.
+func (p *PostgresClient) MigrateDown(ctx context.Context, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, nil
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := p.appliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Target the version below the steps-th most recent applied migration
+	target := 0
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if _, ok := applied[migrations[i].Version]; !ok {
+			continue
+		}
+		if steps--; steps == 0 {
+			if i > 0 {
+				target = migrations[i-1].Version
+			}
+			break
+		}
+	}
+	return p.MigrateTo(ctx, target)
+}
+
+// MigrateTo applies or reverts migrations until exactly those up to version are applied,
+// and returns how many migrations ran. Each migration runs in its own transaction together
+// with its schema_migrations row, so a failed migration leaves the previous version intact.
+func (p *PostgresClient) MigrateTo(ctx context.Context, version int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	if version != 0 && !slices.ContainsFunc(migrations, func(m Migration) bool { return m.Version == version }) {
+		return 0, fmt.Errorf("unknown migration version %d", version)
+	}
+	if err := p.DB.WithContext(ctx).Exec(createSchemaMigrations).Error; err != nil {
+		return 0, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	ran := 0
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		done, err := p.runMigration(ctx, m, true)
+		if err != nil {
+			return ran, err
+		}
+		if done {
+			ran++
+		}
+	}
+	for i := len(migrations) - 1; i >= 0 && migrations[i].Version > version; i-- {
+		done, err := p.runMigration(ctx, migrations[i], false)
+		if err != nil {
+			return ran, err
+		}
+		if done {
+			ran++
+		}
+	}
+	return ran, nil
+}
+
+// runMigration applies (up) or reverts one migration unless it is already in that state.
+// The advisory lock makes a concurrent collector wait and then see the migration as done.
+func (p *PostgresClient) runMigration(ctx context.Context, m Migration, up bool) (bool, error) {
+	done := false
+	err := p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("lock migrations: %w", err)
+		}
+
+		var count int64
+		if err := tx.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&count).Error; err != nil {
+			return fmt.Errorf("read schema_migrations: %w", err)
+		}
+		if applied := count > 0; applied == up {
+			return nil
+		}
+
+		if up {
+			if err := tx.Exec(m.Up).Error; err != nil {
+				return fmt.Errorf("apply migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			row := schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&row).Error; err != nil {
+				return fmt.Errorf("record migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		} else {
+			if err := tx.Exec(m.Down).Error; err != nil {
+				return fmt.Errorf("revert migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			if err := tx.Delete(&schemaMigration{}, m.Version).Error; err != nil {
+				return fmt.Errorf("unrecord migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+		done = true
+		return nil
+	})
+	return done, err
+}
+
+// appliedMigrations reads schema_migrations; a database without the table has none applied.
+func (p *PostgresClient) appliedMigrations(ctx context.Context) (map[int]schemaMigration, error) {
+	db := p.DB.WithContext(ctx)
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return map[int]schemaMigration{}, nil
+	}
+
+	var rows []schemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	applied := make(map[int]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
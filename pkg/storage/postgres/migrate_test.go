@@ -0,0 +1,172 @@
+package postgres_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"wscollector/config"
+	"wscollector/pkg/storage/postgres"
+)
+
+// go test -v --run TestEmbeddedMigrations
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := postgres.Migrations()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %s has version %d, want %d (versions must be consecutive)", m.Name, m.Version, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %04d_%s has an empty up or down script", m.Version, m.Name)
+		}
+	}
+
+	latest, err := postgres.LatestMigration()
+	if err != nil || latest != migrations[len(migrations)-1].Version {
+		t.Errorf("LatestMigration() = %d, %v", latest, err)
+	}
+}
+
+// go test -v --run TestMigrateUp
+func TestMigrateUp(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	// A second run is a no-op
+	ran, err := client.MigrateUp(ctx)
+	if err != nil {
+		t.Fatalf("failed to re-run migrations: %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("second MigrateUp ran %d migrations, want 0", ran)
+	}
+	if err := client.CheckSchema(ctx); err != nil {
+		t.Errorf("CheckSchema after MigrateUp: %v", err)
+	}
+
+	states, err := client.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("failed to read migration status: %v", err)
+	}
+	for _, s := range states {
+		if !s.Applied {
+			t.Errorf("migration %04d_%s not applied", s.Version, s.Name)
+		}
+	}
+}
+
+// go test -v --run TestMigrateUpFromBaseline
+func TestMigrateUpFromBaseline(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	admin, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer admin.Close()
+
+	// A schema of its own stands in for a database created by the GORM-migrated baseline
+	const schema = "baseline_upgrade_test"
+	admin.DB.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+	if err := admin.DB.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	defer admin.DB.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+
+	client, err := postgres.NewClient(cfg.DSN("dev") + " search_path=" + schema)
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	baseline := []string{
+		`CREATE TABLE kline_record (
+			id bigserial PRIMARY KEY,
+			symbol text NOT NULL,
+			interval varchar(10) NOT NULL,
+			start timestamptz NOT NULL,
+			confirm boolean NOT NULL,
+			"end" timestamptz NOT NULL,
+			open numeric NOT NULL,
+			close numeric NOT NULL,
+			high numeric NOT NULL,
+			low numeric NOT NULL,
+			volume numeric NOT NULL,
+			turnover numeric NOT NULL,
+			timestamp timestamptz NOT NULL,
+			recorded_at timestamptz
+		)`,
+		`CREATE UNIQUE INDEX idx_symbol_interval_start_confirm ON kline_record (symbol, interval, start, confirm)`,
+		`CREATE INDEX idx_kline_symbol ON kline_record (symbol)`,
+		`CREATE INDEX idx_kline_timestamp ON kline_record (timestamp)`,
+		// A forming row next to its confirmed row, and a candle that is still forming
+		`INSERT INTO kline_record (symbol, interval, start, confirm, "end", open, close, high, low, volume, turnover, timestamp)
+		VALUES ('BTCUSDT', '1m', '2024-01-01 00:00Z', false, '2024-01-01 00:00:59Z', 1, 1, 1, 1, 1, 1, now()),
+		       ('BTCUSDT', '1m', '2024-01-01 00:00Z', true,  '2024-01-01 00:00:59Z', 1, 2, 2, 1, 3, 3, now()),
+		       ('BTCUSDT', '1m', '2024-01-01 00:01Z', false, '2024-01-01 00:01:59Z', 2, 2, 2, 2, 1, 1, now())`,
+	}
+	for _, stmt := range baseline {
+		if err := client.DB.Exec(stmt).Error; err != nil {
+			t.Fatalf("failed to create baseline schema: %v", err)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate baseline schema: %v", err)
+	}
+
+	var rows []postgres.KlineRecord
+	if err := client.DB.Order("start").Find(&rows).Error; err != nil {
+		t.Fatalf("failed to read klines: %v", err)
+	}
+	if len(rows) != 2 || !rows[0].Confirm || rows[0].Close.String() != "2" || rows[1].Confirm {
+		t.Fatalf("unexpected klines after upgrade: %+v", rows)
+	}
+	for _, r := range rows {
+		if r.PriceType != "last" {
+			t.Errorf("kline %s has price_type %q, want last", r.Start, r.PriceType)
+		}
+	}
+
+	// The new unique key rejects a second row for the same candle
+	dup := rows[0]
+	dup.ID = 0
+	if err := client.DB.Create(&dup).Error; err == nil {
+		t.Error("expected the unique index to reject a duplicate candle")
+	}
+}
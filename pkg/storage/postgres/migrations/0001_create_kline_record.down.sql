@@ -0,0 +1,2 @@
+-- CASCADE also drops Timescale continuous aggregates built on the table.
+DROP TABLE IF EXISTS kline_record CASCADE;
@@ -0,0 +1,41 @@
+-- Kline table as previously created by GORM AutoMigrate; IF NOT EXISTS adopts existing databases.
+CREATE TABLE IF NOT EXISTS kline_record (
+    id          bigserial PRIMARY KEY,
+    symbol      text        NOT NULL,
+    interval    varchar(10) NOT NULL,
+    price_type  varchar(16) NOT NULL DEFAULT 'last',
+    start       timestamptz NOT NULL,
+    confirm     boolean     NOT NULL,
+    "end"       timestamptz NOT NULL,
+    open        numeric     NOT NULL,
+    close       numeric     NOT NULL,
+    high        numeric     NOT NULL,
+    low         numeric     NOT NULL,
+    volume      numeric     NOT NULL,
+    turnover    numeric     NOT NULL,
+    timestamp   timestamptz NOT NULL,
+    recorded_at timestamptz
+);
+
+-- Tables from before price_type hold only last-traded klines.
+ALTER TABLE kline_record ADD COLUMN IF NOT EXISTS price_type varchar(16) NOT NULL DEFAULT 'last';
+
+-- Superseded unique keys: the first lacked price_type, and both included confirm,
+-- which let a forming row and its confirmed row coexist.
+DROP INDEX IF EXISTS idx_symbol_interval_start_confirm;
+DROP INDEX IF EXISTS idx_symbol_interval_price_type_start_confirm;
+
+-- Drop forming rows left next to their confirmed row so the new key can be built.
+DELETE FROM kline_record forming
+USING kline_record confirmed
+WHERE NOT forming.confirm
+  AND confirmed.confirm
+  AND forming.symbol = confirmed.symbol
+  AND forming.interval = confirmed.interval
+  AND forming.price_type = confirmed.price_type
+  AND forming.start = confirmed.start;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_symbol_interval_price_type_start
+    ON kline_record (symbol, interval, price_type, start);
+CREATE INDEX IF NOT EXISTS idx_kline_symbol ON kline_record (symbol);
+CREATE INDEX IF NOT EXISTS idx_kline_timestamp ON kline_record (timestamp);
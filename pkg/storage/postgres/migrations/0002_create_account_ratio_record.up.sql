@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS account_ratio_record (
+    id          bigserial PRIMARY KEY,
+    symbol      text        NOT NULL,
+    period      varchar(10) NOT NULL,
+    timestamp   timestamptz NOT NULL,
+    buy_ratio   numeric     NOT NULL,
+    sell_ratio  numeric     NOT NULL,
+    recorded_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_ratio_symbol_period_timestamp
+    ON account_ratio_record (symbol, period, timestamp);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS indicator_record (
+    id          bigserial PRIMARY KEY,
+    symbol      text             NOT NULL,
+    interval    varchar(10)      NOT NULL,
+    start       timestamptz      NOT NULL,
+    name        varchar(32)      NOT NULL,
+    value       double precision NOT NULL,
+    recorded_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_indicator_symbol_interval_start_name
+    ON indicator_record (symbol, interval, start, name);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS correlation_record (
+    id          bigserial PRIMARY KEY,
+    symbol      text             NOT NULL,
+    benchmark   text             NOT NULL,
+    interval    varchar(10)      NOT NULL,
+    window_size bigint           NOT NULL,
+    as_of       timestamptz      NOT NULL,
+    correlation double precision NOT NULL,
+    beta        double precision NOT NULL,
+    samples     bigint           NOT NULL,
+    recorded_at timestamptz
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_correlation_symbol_benchmark_interval_window_as_of
+    ON correlation_record (symbol, benchmark, interval, window_size, as_of);
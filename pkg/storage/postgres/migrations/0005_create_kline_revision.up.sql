@@ -0,0 +1,21 @@
+-- Conflicting versions of confirmed klines, kept when the conflict policy is "revision".
+-- The row in kline_record stays as first written; each differing delivery is appended here.
+CREATE TABLE IF NOT EXISTS kline_revision (
+    id          bigserial PRIMARY KEY,
+    symbol      text        NOT NULL,
+    interval    varchar(10) NOT NULL,
+    price_type  varchar(16) NOT NULL,
+    start       timestamptz NOT NULL,
+    "end"       timestamptz NOT NULL,
+    open        numeric     NOT NULL,
+    close       numeric     NOT NULL,
+    high        numeric     NOT NULL,
+    low         numeric     NOT NULL,
+    volume      numeric     NOT NULL,
+    turnover    numeric     NOT NULL,
+    timestamp   timestamptz NOT NULL,
+    recorded_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_kline_revision_symbol_interval_price_type_start
+    ON kline_revision (symbol, interval, price_type, start);
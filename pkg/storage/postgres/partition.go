@@ -0,0 +1,438 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/bybit"
+
+	"gorm.io/gorm"
+)
+
+// kline_record is partitioned in two levels: by LIST (interval) into kline_part_<interval>,
+// with intervals that have no partition of their own in kline_part_default, and each of
+// those by RANGE (start) into kline_part_<interval>_pYYYYMMDD named after the period start.
+// Retention (see ApplyRetention) then drops whole per-interval partitions instead of deleting rows.
+const (
+	partitionPrefix   = "kline_part_"
+	defaultPartition  = "default"
+	partitionStaging  = "kline_record_partitioned"
+	defaultPartPeriod = "month"
+)
+
+var partitionName = regexp.MustCompile(`^kline_part_([a-z0-9]+)_p(\d{8})$`)
+
+// KlinePartition is one range partition of kline_record.
+type KlinePartition struct {
+	Name     string
+	Interval string // DB interval, or "default" for the shared partition
+	From     time.Time
+	To       time.Time // exclusive
+}
+
+// partitionScheme is a validated config.PartitionConfig.
+type partitionScheme struct {
+	period    string
+	premake   int
+	intervals []string // intervals with their own list partition
+	copyBatch int
+}
+
+func newPartitionScheme(cfg config.PartitionConfig) (*partitionScheme, error) {
+	s := &partitionScheme{
+		period:    cfg.Period,
+		premake:   cfg.Premake,
+		copyBatch: cfg.CopyBatch,
+	}
+	if s.period == "" {
+		s.period = defaultPartPeriod
+	}
+	if s.period != "day" && s.period != "week" && s.period != "month" {
+		return nil, fmt.Errorf("invalid partition period %q (want day, week or month)", cfg.Period)
+	}
+	if s.premake <= 0 {
+		s.premake = 2
+	}
+	if s.copyBatch <= 0 {
+		s.copyBatch = 10000
+	}
+
+	for _, interval := range cfg.Intervals {
+		meta, err := bybit.ParseDBInterval(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition interval: %w", err)
+		}
+		if !slices.Contains(s.intervals, meta.DBValue) {
+			s.intervals = append(s.intervals, meta.DBValue)
+		}
+	}
+	return s, nil
+}
+
+// ValidatePartitionConfig reports configuration errors before any partition is created.
+func ValidatePartitionConfig(cfg config.PartitionConfig) error {
+	_, err := newPartitionScheme(cfg)
+	return err
+}
+
+// periodStart truncates t to the start of its partition period in UTC. Weeks start on Monday.
+func (s *partitionScheme) periodStart(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch s.period {
+	case "day":
+		return day
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// nextPeriod returns the start of the period after the one starting at start.
+func (s *partitionScheme) nextPeriod(start time.Time) time.Time {
+	switch s.period {
+	case "day":
+		return start.AddDate(0, 0, 1)
+	case "week":
+		return start.AddDate(0, 0, 7)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
+
+// listPartition names the list partition holding an interval, e.g. kline_part_1m.
+// Identifiers fold to lower case, so the monthly "1M" becomes 1mo to stay apart from "1m".
+func listPartition(interval string) string {
+	return partitionPrefix + strings.ReplaceAll(interval, "M", "mo")
+}
+
+// rangePartition names the range partition of an interval starting at from.
+func rangePartition(interval string, from time.Time) string {
+	return listPartition(interval) + "_p" + from.Format("20060102")
+}
+
+// KlinePartitioned reports whether kline_record is already a partitioned table.
+func (p *PostgresClient) KlinePartitioned(ctx context.Context) (bool, error) {
+	var kind string
+	err := p.DB.WithContext(ctx).
+		Raw("SELECT relkind::text FROM pg_class WHERE oid = to_regclass('kline_record')").
+		Scan(&kind).Error
+	if err != nil {
+		return false, fmt.Errorf("check kline_record partitioning: %w", err)
+	}
+	return kind == "p", nil
+}
+
+// PartitionKlineTable converts a plain kline_record into the partitioned layout while the
+// collector keeps writing to it. Rows are copied in id order into a staging table in batches;
+// an interrupted run resumes from the highest copied id. The final batch and the rename run
+// under a short exclusive lock, and the old table is kept as kline_record_legacy.
+// It returns false if kline_record was already partitioned.
+func (p *PostgresClient) PartitionKlineTable(ctx context.Context, cfg config.PartitionConfig,
+	progress func(copied int64)) (bool, error) {
+	scheme, err := newPartitionScheme(cfg)
+	if err != nil {
+		return false, err
+	}
+	partitioned, err := p.KlinePartitioned(ctx)
+	if err != nil || partitioned {
+		return false, err
+	}
+
+	db := p.DB.WithContext(ctx)
+	var legacy bool
+	if err := db.Raw("SELECT to_regclass('kline_record_legacy') IS NOT NULL").Scan(&legacy).Error; err != nil {
+		return false, fmt.Errorf("check legacy kline table: %w", err)
+	}
+	if legacy {
+		return false, errors.New("kline_record_legacy exists from an earlier migration; drop it first")
+	}
+
+	// The staging table mirrors kline_record's columns, defaults and id sequence.
+	// Every unique key of a partitioned table has to include interval and start.
+	if err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + partitionStaging + `
+		(LIKE kline_record INCLUDING DEFAULTS INCLUDING CONSTRAINTS,
+		CONSTRAINT kline_record_partitioned_pkey PRIMARY KEY (id, interval, start))
+		PARTITION BY LIST (interval)`).Error; err != nil {
+		return false, fmt.Errorf("create partitioned kline table: %w", err)
+	}
+
+	var oldest sql.NullTime
+	if err := db.Raw("SELECT min(start) FROM kline_record").Scan(&oldest).Error; err != nil {
+		return false, fmt.Errorf("find oldest kline: %w", err)
+	}
+	from := time.Now()
+	if oldest.Valid {
+		from = oldest.Time
+	}
+	if err := p.createPartitions(ctx, scheme, partitionStaging, from, time.Now()); err != nil {
+		return false, err
+	}
+	for _, index := range []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_symbol_interval_price_type_start_part ON " + partitionStaging + " (symbol, interval, price_type, start)",
+		"CREATE INDEX IF NOT EXISTS idx_kline_symbol_part ON " + partitionStaging + " (symbol)",
+		"CREATE INDEX IF NOT EXISTS idx_kline_timestamp_part ON " + partitionStaging + " (timestamp)",
+	} {
+		if err := db.Exec(index).Error; err != nil {
+			return false, fmt.Errorf("create partitioned kline index: %w", err)
+		}
+	}
+
+	// Ids are allocated before commit, so a batch can pass over rows whose transaction was
+	// still open. Each pass therefore starts a minute of ids back; ON CONFLICT skips repeats.
+	var copied int64
+	var lastID uint
+	if err := db.Raw(`SELECT coalesce(min(id) - 1, 0) FROM ` + partitionStaging + `
+		WHERE recorded_at >= (SELECT max(recorded_at) FROM ` + partitionStaging + `) - INTERVAL '1 minute'`).
+		Scan(&lastID).Error; err != nil {
+		return false, fmt.Errorf("resume kline copy: %w", err)
+	}
+	type checkpoint struct {
+		at time.Time
+		id uint
+	}
+	var checkpoints []checkpoint
+	for {
+		checkpoints = append(checkpoints, checkpoint{time.Now(), lastID})
+		n, next, err := copyKlineBatch(db, lastID, scheme.copyBatch)
+		if err != nil {
+			return false, err
+		}
+		if n.read == 0 {
+			break
+		}
+		copied += n.inserted
+		lastID = next
+		if progress != nil {
+			progress(copied)
+		}
+	}
+	recopyFrom := uint(0)
+	for _, c := range checkpoints {
+		if time.Since(c.at) >= time.Minute {
+			recopyFrom = c.id
+		}
+	}
+
+	// Cover periods that began while copying before taking the lock
+	if err := p.createPartitions(ctx, scheme, partitionStaging, time.Now(), time.Now()); err != nil {
+		return false, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("LOCK TABLE kline_record IN ACCESS EXCLUSIVE MODE").Error; err != nil {
+			return fmt.Errorf("lock kline_record: %w", err)
+		}
+		// Rows written since the last batch, or committed late during the last minute
+		for after := recopyFrom; ; {
+			n, next, err := copyKlineBatch(tx, after, scheme.copyBatch)
+			if err != nil {
+				return err
+			}
+			if n.read == 0 {
+				break
+			}
+			copied += n.inserted
+			after = next
+		}
+		// Forming rows may have been updated or confirmed in place after they were copied
+		if err := tx.Exec(`UPDATE ` + partitionStaging + ` AS n SET
+			"end" = o."end", open = o.open, close = o.close, high = o.high, low = o.low,
+			volume = o.volume, turnover = o.turnover, confirm = o.confirm, timestamp = o.timestamp
+			FROM kline_record AS o
+			WHERE n.id = o.id AND n.interval = o.interval AND n.start = o.start AND NOT n.confirm`).Error; err != nil {
+			return fmt.Errorf("refresh forming klines: %w", err)
+		}
+
+		for _, stmt := range []string{
+			"ALTER TABLE kline_record RENAME TO kline_record_legacy",
+			"ALTER TABLE kline_record_legacy RENAME CONSTRAINT kline_record_pkey TO kline_record_legacy_pkey",
+			"ALTER INDEX IF EXISTS idx_symbol_interval_price_type_start RENAME TO idx_symbol_interval_price_type_start_legacy",
+			"ALTER INDEX IF EXISTS idx_kline_symbol RENAME TO idx_kline_symbol_legacy",
+			"ALTER INDEX IF EXISTS idx_kline_timestamp RENAME TO idx_kline_timestamp_legacy",
+			"ALTER TABLE " + partitionStaging + " RENAME TO kline_record",
+			"ALTER TABLE kline_record RENAME CONSTRAINT kline_record_partitioned_pkey TO kline_record_pkey",
+			"ALTER INDEX idx_symbol_interval_price_type_start_part RENAME TO idx_symbol_interval_price_type_start",
+			"ALTER INDEX idx_kline_symbol_part RENAME TO idx_kline_symbol",
+			"ALTER INDEX idx_kline_timestamp_part RENAME TO idx_kline_timestamp",
+			// Keep the shared id sequence when the legacy table is dropped
+			"ALTER SEQUENCE IF EXISTS kline_record_id_seq OWNED BY kline_record.id",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("swap partitioned kline table: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if progress != nil {
+		progress(copied)
+	}
+	return true, nil
+}
+
+// copyCount is the outcome of one copy batch.
+type copyCount struct {
+	read     int64 // rows read from kline_record
+	inserted int64 // rows not yet in the staging table
+}
+
+// copyKlineBatch copies up to limit rows with id > after into the staging table and returns
+// the counts and the highest id read.
+func copyKlineBatch(db *gorm.DB, after uint, limit int) (copyCount, uint, error) {
+	var result struct {
+		Read     int64
+		Inserted int64
+		MaxID    uint
+	}
+	err := db.Raw(`WITH batch AS (
+			SELECT * FROM kline_record WHERE id > ? ORDER BY id LIMIT ?
+		), copied AS (
+			INSERT INTO `+partitionStaging+` SELECT * FROM batch ON CONFLICT DO NOTHING RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM batch) AS read,
+			(SELECT count(*) FROM copied) AS inserted,
+			(SELECT coalesce(max(id), 0) FROM batch) AS max_id`, after, limit).
+		Scan(&result).Error
+	if err != nil {
+		return copyCount{}, 0, fmt.Errorf("copy kline batch after id %d: %w", after, err)
+	}
+	return copyCount{read: result.Read, inserted: result.Inserted}, result.MaxID, nil
+}
+
+// EnsureKlinePartitions creates the list partitions and the range partitions from the
+// current period through the configured number of upcoming periods. It is idempotent.
+func (p *PostgresClient) EnsureKlinePartitions(ctx context.Context, cfg config.PartitionConfig, now time.Time) error {
+	scheme, err := newPartitionScheme(cfg)
+	if err != nil {
+		return err
+	}
+	return p.createPartitions(ctx, scheme, "kline_record", now, now)
+}
+
+// createPartitions creates partitions of parent covering [from, to] plus scheme.premake periods.
+func (p *PostgresClient) createPartitions(ctx context.Context, scheme *partitionScheme, parent string,
+	from, to time.Time) error {
+	db := p.DB.WithContext(ctx)
+
+	lists := append(slices.Clone(scheme.intervals), defaultPartition)
+	for _, interval := range lists {
+		bound := "DEFAULT"
+		if interval != defaultPartition {
+			bound = fmt.Sprintf("FOR VALUES IN ('%s')", interval)
+		}
+		stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s %s PARTITION BY RANGE (start)",
+			listPartition(interval), parent, bound)
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("create %s partition: %w", interval, err)
+		}
+
+		end := to
+		for range scheme.premake {
+			end = scheme.nextPeriod(scheme.periodStart(end))
+		}
+		for start := scheme.periodStart(from); !start.After(end); start = scheme.nextPeriod(start) {
+			stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+				rangePartition(interval, start), listPartition(interval),
+				start.Format(time.RFC3339), scheme.nextPeriod(start).Format(time.RFC3339))
+			if err := db.Exec(stmt).Error; err != nil {
+				return fmt.Errorf("create %s partition from %s: %w", interval, start.Format(time.DateOnly), err)
+			}
+		}
+	}
+	return nil
+}
+
+// KlinePartitions lists the range partitions of kline_record, oldest first per interval.
+func (p *PostgresClient) KlinePartitions(ctx context.Context, cfg config.PartitionConfig) ([]KlinePartition, error) {
+	scheme, err := newPartitionScheme(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	err = p.DB.WithContext(ctx).Raw(`SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class parent ON parent.oid = i.inhparent
+		JOIN pg_inherits top ON top.inhrelid = parent.oid
+		WHERE top.inhparent = to_regclass('kline_record')
+		ORDER BY c.relname`).Scan(&names).Error
+	if err != nil {
+		return nil, fmt.Errorf("list kline partitions: %w", err)
+	}
+
+	intervals := map[string]string{strings.TrimPrefix(listPartition(defaultPartition), partitionPrefix): defaultPartition}
+	for _, interval := range scheme.intervals {
+		intervals[strings.TrimPrefix(listPartition(interval), partitionPrefix)] = interval
+	}
+
+	var partitions []KlinePartition
+	for _, name := range names {
+		match := partitionName.FindStringSubmatch(name)
+		if match == nil {
+			continue // not created by this scheme
+		}
+		from, err := time.Parse("20060102", match[2])
+		if err != nil {
+			continue
+		}
+		interval, ok := intervals[match[1]]
+		if !ok {
+			interval = match[1]
+		}
+		partitions = append(partitions, KlinePartition{
+			Name:     name,
+			Interval: interval,
+			From:     from,
+			To:       scheme.nextPeriod(from),
+		})
+	}
+	return partitions, nil
+}
+
+// DropKlinePartitionsBefore detaches and drops the range partitions of an interval whose whole
+// period ends at or before cutoff, and returns them. With dryRun it only returns what would be
+// dropped. Detaching concurrently keeps writes to the parent going.
+func (p *PostgresClient) DropKlinePartitionsBefore(ctx context.Context, cfg config.PartitionConfig,
+	interval string, cutoff time.Time, dryRun bool) ([]KlinePartition, error) {
+	partitions, err := p.KlinePartitions(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var dropped []KlinePartition
+	for _, part := range partitions {
+		if part.Interval != interval || part.To.After(cutoff) {
+			continue
+		}
+		if !dryRun {
+			if err := p.dropPartition(ctx, part); err != nil {
+				return dropped, err
+			}
+		}
+		dropped = append(dropped, part)
+	}
+	return dropped, nil
+}
+
+func (p *PostgresClient) dropPartition(ctx context.Context, part KlinePartition) error {
+	db := p.DB.WithContext(ctx)
+	// DETACH CONCURRENTLY cannot run in a transaction; Exec runs in autocommit
+	detach := fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s CONCURRENTLY", listPartition(part.Interval), part.Name)
+	if err := db.Exec(detach).Error; err != nil {
+		return fmt.Errorf("detach partition %s: %w", part.Name, err)
+	}
+	if err := db.Exec("DROP TABLE IF EXISTS " + part.Name).Error; err != nil {
+		return fmt.Errorf("drop partition %s: %w", part.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"wscollector/config"
+)
+
+func TestPartitionPeriods(t *testing.T) {
+	at := time.Date(2026, 10, 15, 13, 45, 0, 0, time.UTC) // a Thursday
+
+	tests := []struct {
+		period      string
+		start, next time.Time
+	}{
+		{"day", time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)},
+		{"week", time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		{"month", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		scheme, err := newPartitionScheme(config.PartitionConfig{Period: tt.period})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.period, err)
+		}
+		start := scheme.periodStart(at)
+		if !start.Equal(tt.start) {
+			t.Errorf("%q: periodStart = %s, want %s", tt.period, start, tt.start)
+		}
+		if next := scheme.nextPeriod(start); !next.Equal(tt.next) {
+			t.Errorf("%q: nextPeriod = %s, want %s", tt.period, next, tt.next)
+		}
+	}
+
+	// Sunday belongs to the week that started on Monday
+	scheme, _ := newPartitionScheme(config.PartitionConfig{Period: "week"})
+	sunday := time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)
+	if got := scheme.periodStart(sunday); !got.Equal(time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("periodStart(sunday) = %s", got)
+	}
+}
+
+func TestPartitionNames(t *testing.T) {
+	from := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := rangePartition("1m", from); got != "kline_part_1m_p20261001" {
+		t.Errorf("rangePartition(1m) = %s", got)
+	}
+	// Monthly candles must not collide with 1m once identifiers fold to lower case
+	if got := listPartition("1M"); got != "kline_part_1mo" {
+		t.Errorf("listPartition(1M) = %s", got)
+	}
+	if !partitionName.MatchString(rangePartition(defaultPartition, from)) {
+		t.Error("default range partition does not match the partition name pattern")
+	}
+}
+
+func TestPartitionSchemeValidation(t *testing.T) {
+	invalid := []config.PartitionConfig{
+		{Period: "year"},
+		{Intervals: []string{"7x"}},
+	}
+	for _, cfg := range invalid {
+		if _, err := newPartitionScheme(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+
+	scheme, err := newPartitionScheme(config.PartitionConfig{Intervals: []string{"1m", "1h", "1m"}})
+	if err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	if len(scheme.intervals) != 2 {
+		t.Errorf("duplicate interval kept: %v", scheme.intervals)
+	}
+}
@@ -0,0 +1,180 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/bybit"
+
+	"gorm.io/gorm"
+)
+
+// RetentionRun reports what one retention rule removed, or would remove in a dry run.
+type RetentionRun struct {
+	Rule       config.RetentionRule
+	Cutoff     time.Time // klines starting before this are removed
+	Rows       int64
+	Partitions []KlinePartition
+	Took       time.Duration
+}
+
+// ValidateRetentionConfig checks the intervals and symbol patterns of the retention rules.
+func ValidateRetentionConfig(cfg config.RetentionConfig) error {
+	for _, rule := range cfg.Rules {
+		if _, err := bybit.ParseDBInterval(rule.Interval); err != nil {
+			return fmt.Errorf("invalid retention interval: %w", err)
+		}
+		if strings.ContainsAny(rule.Symbols, "[]") {
+			return fmt.Errorf("invalid retention symbols %q: only * and ? are supported", rule.Symbols)
+		}
+		if rule.Keep < 0 {
+			return fmt.Errorf("retention for %s needs a non-negative keep", rule.Interval)
+		}
+	}
+	return nil
+}
+
+// ApplyRetention removes klines older than their rule allows, rule by rule. A rule that covers
+// a whole interval with list partitions of its own on a partitioned kline_record first drops
+// the partitions that lie entirely before the cutoff; the remaining rows are deleted in chunks of cfg.ChunkSize so no statement
+// holds locks for long. With cfg.DryRun nothing is removed and the runs report what would be.
+func (p *PostgresClient) ApplyRetention(ctx context.Context, cfg config.RetentionConfig,
+	partition config.PartitionConfig, now time.Time) ([]RetentionRun, error) {
+	if err := ValidateRetentionConfig(cfg); err != nil {
+		return nil, err
+	}
+	chunk := cfg.ChunkSize
+	if chunk <= 0 {
+		chunk = 5000
+	}
+
+	partitioned := false
+	if partition.Enabled {
+		var err error
+		if partitioned, err = p.KlinePartitioned(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var runs []RetentionRun
+	for i, rule := range cfg.Rules {
+		if rule.Keep == 0 {
+			continue // kept forever
+		}
+		began := time.Now()
+		run := RetentionRun{Rule: rule, Cutoff: now.Add(-rule.Keep)}
+
+		// Earlier rules for the same interval take precedence over this one
+		var earlier []string
+		shadowed := false
+		for _, prev := range cfg.Rules[:i] {
+			if prev.Interval == rule.Interval {
+				earlier = append(earlier, prev.Symbols)
+				shadowed = shadowed || matchesAll(prev.Symbols)
+			}
+		}
+		if shadowed {
+			continue
+		}
+		whole := len(earlier) == 0 && matchesAll(rule.Symbols)
+
+		from := time.Time{}
+		if whole && partitioned && slices.Contains(partition.Intervals, rule.Interval) {
+			dropped, err := p.DropKlinePartitionsBefore(ctx, partition, rule.Interval, run.Cutoff, cfg.DryRun)
+			run.Partitions = dropped
+			if err != nil {
+				return append(runs, run), err
+			}
+			for _, part := range dropped {
+				from = maxTime(from, part.To)
+			}
+		}
+
+		scope := func(db *gorm.DB) *gorm.DB {
+			db = db.Where("interval = ? AND start < ?", rule.Interval, run.Cutoff)
+			if !from.IsZero() {
+				db = db.Where("start >= ?", from)
+			}
+			if !matchesAll(rule.Symbols) {
+				db = db.Where("symbol LIKE ?", globToLike(rule.Symbols))
+			}
+			for _, pattern := range earlier {
+				db = db.Where("symbol NOT LIKE ?", globToLike(pattern))
+			}
+			return db
+		}
+
+		var err error
+		if cfg.DryRun {
+			err = scope(p.DB.WithContext(ctx).Model(&KlineRecord{})).Count(&run.Rows).Error
+		} else {
+			run.Rows, err = p.deleteKlineChunks(ctx, rule.Interval, scope, chunk, cfg.ChunkPause)
+		}
+		run.Took = time.Since(began)
+		runs = append(runs, run)
+		if err != nil {
+			return runs, fmt.Errorf("apply retention for %s: %w", rule.Interval, err)
+		}
+	}
+	return runs, nil
+}
+
+// deleteKlineChunks deletes the rows selected by scope, chunk rows per statement, and
+// returns how many it deleted. Filtering the outer DELETE by interval keeps it to the
+// interval's partition; ids are unique across partitions.
+func (p *PostgresClient) deleteKlineChunks(ctx context.Context, interval string,
+	scope func(*gorm.DB) *gorm.DB, chunk int, pause time.Duration) (int64, error) {
+	var deleted int64
+	for {
+		ids := scope(p.DB.Model(&KlineRecord{}).Select("id")).Limit(chunk)
+		tx := p.DB.WithContext(ctx).Where("interval = ? AND id IN (?)", interval, ids).Delete(&KlineRecord{})
+		if tx.Error != nil {
+			return deleted, tx.Error
+		}
+		deleted += tx.RowsAffected
+		if tx.RowsAffected < int64(chunk) {
+			return deleted, nil
+		}
+
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return deleted, ctx.Err()
+		}
+	}
+}
+
+// matchesAll reports whether a symbols pattern matches every symbol.
+func matchesAll(pattern string) bool {
+	return pattern == "" || pattern == "*"
+}
+
+// globToLike turns a glob pattern (* and ?) into a LIKE pattern with the default \ escape.
+func globToLike(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
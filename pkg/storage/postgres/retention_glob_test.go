@@ -0,0 +1,17 @@
+package postgres
+
+import "testing"
+
+func TestGlobToLike(t *testing.T) {
+	tests := map[string]string{
+		"*USDT":     "%USDT",
+		"BTC?":      "BTC_",
+		"1000_PEPE": `1000\_PEPE`,
+		"50%*":      `50\%%`,
+	}
+	for glob, want := range tests {
+		if got := globToLike(glob); got != want {
+			t.Errorf("globToLike(%q) = %q, want %q", glob, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/decimal"
+	"wscollector/pkg/storage/postgres"
+)
+
+// go test -v --run TestApplyRetention
+func TestApplyRetention(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	now := time.Now().Truncate(time.Minute)
+	for _, symbol := range []string{"RETAUSDT", "RETBUSDT"} {
+		for _, age := range []time.Duration{100 * 24 * time.Hour, 101 * 24 * time.Hour, time.Hour} {
+			start := now.Add(-age)
+			record := &postgres.KlineRecord{
+				Symbol:    symbol,
+				Interval:  "1m",
+				PriceType: "last",
+				Start:     start,
+				End:       start.Add(time.Minute - time.Millisecond),
+				Open:      decimal.MustParse("1.0"),
+				Close:     decimal.MustParse("1.1"),
+				High:      decimal.MustParse("1.2"),
+				Low:       decimal.MustParse("0.9"),
+				Volume:    decimal.MustParse("10"),
+				Turnover:  decimal.MustParse("11"),
+				Confirm:   true,
+				Timestamp: time.Now(),
+			}
+			if _, err := client.InsertKline(ctx, record); err != nil {
+				t.Fatalf("insert failed: %v", err)
+			}
+		}
+	}
+	defer client.DeleteOldKlines(ctx, time.Now())
+
+	// RETB is kept forever by the first rule; RETA falls to the 90-day rule
+	retention := config.RetentionConfig{
+		ChunkSize: 1,
+		DryRun:    true,
+		Rules: []config.RetentionRule{
+			{Interval: "1m", Symbols: "RETB*"},
+			{Interval: "1m", Symbols: "RET?USDT", Keep: 90 * 24 * time.Hour},
+		},
+	}
+
+	runs, err := client.ApplyRetention(ctx, retention, config.PartitionConfig{}, now)
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Rows != 2 {
+		t.Fatalf("unexpected dry run: %+v", runs)
+	}
+
+	retention.DryRun = false
+	runs, err = client.ApplyRetention(ctx, retention, config.PartitionConfig{}, now)
+	if err != nil {
+		t.Fatalf("retention failed: %v", err)
+	}
+	if len(runs) != 1 || runs[0].Rows != 2 {
+		t.Fatalf("unexpected retention run: %+v", runs)
+	}
+
+	for symbol, want := range map[string]int{"RETAUSDT": 1, "RETBUSDT": 3} {
+		got, err := client.GetKlineRange(ctx, []string{symbol}, "1m", now.Add(-200*24*time.Hour), now)
+		if err != nil {
+			t.Fatalf("range read failed: %v", err)
+		}
+		if len(got) != want {
+			t.Errorf("%s has %d klines after retention, want %d", symbol, len(got), want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/bybit"
+	"wscollector/pkg/decimal"
+
+	"gorm.io/gorm"
+)
+
+// ErrTimescaleUnavailable is returned when the database has no TimescaleDB extension.
+// Callers fall back to plain tables.
+var ErrTimescaleUnavailable = errors.New("timescaledb extension not available")
+
+// defaultAggregates are the continuous aggregates created when none are configured.
+var defaultAggregates = []string{"5m", "1h", "1d"}
+
+// SetupTimescale converts kline_record into a hypertable on start, enables compression and
+// creates the configured continuous aggregates from 1m rows. Every step is idempotent, so it
+// runs at each startup. Afterwards GetKlineRange also reads the aggregates.
+//
+// A compression policy that already exists keeps its original age; drop it with
+// remove_compression_policy to change compress_after.
+func (p *PostgresClient) SetupTimescale(ctx context.Context, cfg config.TimescaleConfig) error {
+	aggregates, err := aggregateMinutes(cfg.Aggregates)
+	if err != nil {
+		return err
+	}
+	chunk := cfg.ChunkInterval
+	if chunk <= 0 {
+		chunk = 24 * time.Hour
+	}
+
+	db := p.DB.WithContext(ctx)
+	var available bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')").
+		Scan(&available).Error; err != nil {
+		return fmt.Errorf("check timescaledb extension: %w", err)
+	}
+	if !available {
+		return ErrTimescaleUnavailable
+	}
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb").Error; err != nil {
+		// Installed but not preloaded, or the role may not create extensions
+		return fmt.Errorf("%w: %v", ErrTimescaleUnavailable, err)
+	}
+
+	if err := p.createKlineHypertable(ctx, chunk); err != nil {
+		return err
+	}
+	if cfg.CompressAfter > 0 {
+		if err := p.enableKlineCompression(ctx, cfg.CompressAfter); err != nil {
+			return err
+		}
+	}
+	for interval, minutes := range aggregates {
+		if err := p.createKlineAggregate(ctx, interval, minutes); err != nil {
+			return err
+		}
+	}
+
+	p.aggregates = aggregates
+	return nil
+}
+
+// LoadTimescaleAggregates enables aggregate reads for the configured intervals whose
+// continuous aggregate already exists, without changing the schema. It is used when
+// auto-migration is off and SetupTimescale ran from the migrate command.
+func (p *PostgresClient) LoadTimescaleAggregates(ctx context.Context, cfg config.TimescaleConfig) error {
+	aggregates, err := aggregateMinutes(cfg.Aggregates)
+	if err != nil {
+		return err
+	}
+
+	db := p.DB.WithContext(ctx)
+	var installed bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").
+		Scan(&installed).Error; err != nil {
+		return fmt.Errorf("check timescaledb extension: %w", err)
+	}
+	if !installed {
+		return ErrTimescaleUnavailable
+	}
+
+	var views []string
+	if err := db.Raw("SELECT view_name FROM timescaledb_information.continuous_aggregates").
+		Scan(&views).Error; err != nil {
+		return fmt.Errorf("list continuous aggregates: %w", err)
+	}
+	for interval := range aggregates {
+		if !slices.Contains(views, aggregateView(interval)) {
+			delete(aggregates, interval)
+		}
+	}
+
+	p.aggregates = aggregates
+	return nil
+}
+
+// AggregateIntervals returns the DB intervals served by continuous aggregates.
+func (p *PostgresClient) AggregateIntervals() []string {
+	intervals := make([]string, 0, len(p.aggregates))
+	for interval := range p.aggregates {
+		intervals = append(intervals, interval)
+	}
+	slices.Sort(intervals)
+	return intervals
+}
+
+// createKlineHypertable converts kline_record in place. Timescale requires every unique
+// constraint to include the time column, so the primary key becomes (id, start).
+func (p *PostgresClient) createKlineHypertable(ctx context.Context, chunk time.Duration) error {
+	return p.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var exists bool
+		if err := tx.Raw(`SELECT EXISTS (SELECT 1 FROM timescaledb_information.hypertables
+			WHERE hypertable_name = 'kline_record')`).Scan(&exists).Error; err != nil {
+			return fmt.Errorf("check hypertable: %w", err)
+		}
+		if exists {
+			return nil
+		}
+
+		if err := tx.Exec(`ALTER TABLE kline_record DROP CONSTRAINT IF EXISTS kline_record_pkey,
+			ADD PRIMARY KEY (id, start)`).Error; err != nil {
+			return fmt.Errorf("rekey kline_record: %w", err)
+		}
+		if err := tx.Exec(`SELECT create_hypertable('kline_record', 'start',
+			chunk_time_interval => make_interval(secs => ?), migrate_data => true)`,
+			chunk.Seconds()).Error; err != nil {
+			return fmt.Errorf("create kline hypertable: %w", err)
+		}
+		return nil
+	})
+}
+
+// enableKlineCompression segments compressed chunks by series so range reads of one
+// symbol decompress only its own rows.
+func (p *PostgresClient) enableKlineCompression(ctx context.Context, after time.Duration) error {
+	db := p.DB.WithContext(ctx)
+
+	var enabled bool
+	if err := db.Raw(`SELECT compression_enabled FROM timescaledb_information.hypertables
+		WHERE hypertable_name = 'kline_record'`).Scan(&enabled).Error; err != nil {
+		return fmt.Errorf("check kline compression: %w", err)
+	}
+	if !enabled {
+		if err := db.Exec(`ALTER TABLE kline_record SET (timescaledb.compress,
+			timescaledb.compress_segmentby = 'symbol, interval, price_type',
+			timescaledb.compress_orderby = 'start')`).Error; err != nil {
+			return fmt.Errorf("enable kline compression: %w", err)
+		}
+	}
+
+	if err := db.Exec(`SELECT add_compression_policy('kline_record',
+		make_interval(secs => ?), if_not_exists => true)`, after.Seconds()).Error; err != nil {
+		return fmt.Errorf("add kline compression policy: %w", err)
+	}
+	return nil
+}
+
+// createKlineAggregate builds one interval from confirmed 1m rows. Real-time aggregation is on,
+// so the not yet materialized tail is computed at query time.
+func (p *PostgresClient) createKlineAggregate(ctx context.Context, interval string, minutes int) error {
+	db := p.DB.WithContext(ctx)
+	view := aggregateView(interval)
+	bucket := float64(minutes) * 60
+
+	// The view name comes from a validated interval and the bucket width is a whole
+	// number of seconds, so both can be formatted into the DDL, which takes no bind parameters.
+	create := fmt.Sprintf(`CREATE MATERIALIZED VIEW IF NOT EXISTS %s
+		WITH (timescaledb.continuous, timescaledb.materialized_only = false) AS
+		SELECT symbol, price_type,
+			time_bucket(INTERVAL '%d seconds', start) AS bucket,
+			first(open, start) AS open,
+			max(high) AS high,
+			min(low) AS low,
+			last(close, start) AS close,
+			sum(volume) AS volume,
+			sum(turnover) AS turnover,
+			max(timestamp) AS timestamp,
+			count(*) AS minutes
+		FROM kline_record
+		WHERE interval = '1m' AND confirm
+		GROUP BY symbol, price_type, bucket
+		WITH NO DATA`, view, minutes*60)
+	if err := db.Exec(create).Error; err != nil {
+		return fmt.Errorf("create %s aggregate: %w", interval, err)
+	}
+
+	// Refresh the last few buckets once each bucket closes; late 1m rows within
+	// that window are picked up by the next refresh.
+	if err := db.Exec(`SELECT add_continuous_aggregate_policy(CAST(? AS text)::regclass,
+		start_offset => make_interval(secs => ?),
+		end_offset => make_interval(secs => ?),
+		schedule_interval => make_interval(secs => ?),
+		if_not_exists => true)`, view, 4*bucket, bucket, bucket).Error; err != nil {
+		return fmt.Errorf("add %s aggregate policy: %w", interval, err)
+	}
+	return nil
+}
+
+// klineAggregateRow is a row of a kline_record_<interval> continuous aggregate.
+type klineAggregateRow struct {
+	Symbol    string
+	PriceType string
+	Bucket    time.Time
+	Open      decimal.Decimal
+	High      decimal.Decimal
+	Low       decimal.Decimal
+	Close     decimal.Decimal
+	Volume    decimal.Decimal
+	Turnover  decimal.Decimal
+	Timestamp time.Time
+	Minutes   int
+}
+
+// GetAggregatedKlines reads last-traded klines of one interval with start in [from, to)
+// from its continuous aggregate, ordered by symbol and start. A bucket is confirmed once
+// all of its 1m rows are present. It returns an error if the interval has no aggregate.
+func (p *PostgresClient) GetAggregatedKlines(ctx context.Context, symbols []string, interval string,
+	from, to time.Time) ([]KlineRecord, error) {
+	minutes, ok := p.aggregates[interval]
+	if !ok {
+		return nil, fmt.Errorf("no continuous aggregate for interval %s", interval)
+	}
+
+	var rows []klineAggregateRow
+	err := p.DB.WithContext(ctx).
+		Table(aggregateView(interval)).
+		Where("symbol IN ? AND price_type = ? AND bucket >= ? AND bucket < ?", symbols, "last", from, to).
+		Order("symbol, bucket").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	span := time.Duration(minutes) * time.Minute
+	klines := make([]KlineRecord, len(rows))
+	for i, r := range rows {
+		klines[i] = KlineRecord{
+			Symbol:    r.Symbol,
+			Interval:  interval,
+			PriceType: r.PriceType,
+			Start:     r.Bucket,
+			End:       r.Bucket.Add(span - time.Millisecond),
+			Confirm:   r.Minutes == minutes,
+			Open:      r.Open,
+			Close:     r.Close,
+			High:      r.High,
+			Low:       r.Low,
+			Volume:    r.Volume,
+			Turnover:  r.Turnover,
+			Timestamp: r.Timestamp,
+		}
+	}
+	return klines, nil
+}
+
+// mergeAggregated adds confirmed aggregate klines for candles missing from stored, which is
+// ordered by symbol and start. Stored rows come from Bybit and win over aggregated ones.
+func mergeAggregated(stored, aggregated []KlineRecord) []KlineRecord {
+	type key struct {
+		symbol string
+		start  int64
+	}
+	seen := make(map[key]bool, len(stored))
+	for _, k := range stored {
+		seen[key{k.Symbol, k.Start.UnixMilli()}] = true
+	}
+
+	merged := stored
+	for _, k := range aggregated {
+		if k.Confirm && !seen[key{k.Symbol, k.Start.UnixMilli()}] {
+			merged = append(merged, k)
+		}
+	}
+	if len(merged) == len(stored) {
+		return stored
+	}
+	slices.SortFunc(merged, func(a, b KlineRecord) int {
+		if a.Symbol != b.Symbol {
+			if a.Symbol < b.Symbol {
+				return -1
+			}
+			return 1
+		}
+		return a.Start.Compare(b.Start)
+	})
+	return merged
+}
+
+// aggregateMinutes validates aggregate intervals and returns their bucket size in minutes.
+func aggregateMinutes(intervals []string) (map[string]int, error) {
+	if len(intervals) == 0 {
+		intervals = defaultAggregates
+	}
+	out := make(map[string]int, len(intervals))
+	for _, interval := range intervals {
+		meta, err := bybit.ParseDBInterval(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timescale aggregate: %w", err)
+		}
+		if meta.Minutes <= 1 || meta.Minutes > 1440 {
+			return nil, fmt.Errorf("timescale aggregate %s must be longer than 1m and at most 1d", interval)
+		}
+		out[meta.DBValue] = meta.Minutes
+	}
+	return out, nil
+}
+
+// aggregateView names the continuous aggregate of an interval, e.g. kline_record_1h.
+func aggregateView(interval string) string {
+	return "kline_record_" + interval
+}
@@ -0,0 +1,38 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeAggregated(t *testing.T) {
+	at := func(minute int) time.Time { return time.UnixMilli(0).Add(time.Duration(minute) * time.Minute) }
+
+	stored := []KlineRecord{
+		{Symbol: "BTCUSDT", Start: at(0), Confirm: true},
+		{Symbol: "ETHUSDT", Start: at(5), Confirm: true},
+	}
+	aggregated := []KlineRecord{
+		{Symbol: "BTCUSDT", Start: at(0), Confirm: true, Interval: "aggregated"}, // stored row wins
+		{Symbol: "BTCUSDT", Start: at(5), Confirm: true},
+		{Symbol: "BTCUSDT", Start: at(10), Confirm: false}, // incomplete bucket
+		{Symbol: "ETHUSDT", Start: at(0), Confirm: true},
+	}
+
+	got := mergeAggregated(stored, aggregated)
+	want := []struct {
+		symbol string
+		minute int
+	}{{"BTCUSDT", 0}, {"BTCUSDT", 5}, {"ETHUSDT", 0}, {"ETHUSDT", 5}}
+	if len(got) != len(want) {
+		t.Fatalf("got %d klines, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Symbol != w.symbol || !got[i].Start.Equal(at(w.minute)) {
+			t.Errorf("kline %d = %s@%s, want %s@%s", i, got[i].Symbol, got[i].Start, w.symbol, at(w.minute))
+		}
+	}
+	if got[0].Interval == "aggregated" {
+		t.Error("aggregated kline replaced a stored one")
+	}
+}
@@ -0,0 +1,80 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"wscollector/config"
+	"wscollector/pkg/decimal"
+	"wscollector/pkg/storage/postgres"
+)
+
+// go test -v --run TestTimescaleAggregates
+func TestTimescaleAggregates(t *testing.T) {
+	cfg := config.PostgresConfig{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "yourpw",
+		DBName:   "wscollector",
+		SSLMode:  "disable",
+		TimeZone: "UTC",
+	}
+
+	client, err := postgres.NewClient(cfg.DSN("dev"))
+	if err != nil {
+		t.Fatalf("failed to connect to DB: %v", err)
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+
+	if _, err := client.MigrateUp(ctx); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	err = client.SetupTimescale(ctx, config.TimescaleConfig{Enabled: true, Aggregates: []string{"5m"}})
+	if errors.Is(err, postgres.ErrTimescaleUnavailable) {
+		t.Skip("timescaledb not installed")
+	}
+	if err != nil {
+		t.Fatalf("timescale setup failed: %v", err)
+	}
+
+	// Five 1m candles make one complete 5m bucket; the sixth starts an incomplete one
+	base := time.Now().UTC().Truncate(5 * time.Minute).Add(-time.Hour)
+	for i := 0; i < 6; i++ {
+		start := base.Add(time.Duration(i) * time.Minute)
+		record := &postgres.KlineRecord{
+			Symbol:    "AGGUSDT",
+			Interval:  "1m",
+			PriceType: "last",
+			Start:     start,
+			End:       start.Add(time.Minute - time.Millisecond),
+			Open:      decimal.MustParse("1.0"),
+			Close:     decimal.MustParse("1.1"),
+			High:      decimal.MustParse("1.2"),
+			Low:       decimal.MustParse("0.9"),
+			Volume:    decimal.MustParse("10"),
+			Turnover:  decimal.MustParse("11"),
+			Confirm:   true,
+			Timestamp: time.Now(),
+		}
+		if _, err := client.InsertKline(ctx, record); err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+	}
+	defer client.DeleteOldKlines(ctx, time.Now())
+
+	got, err := client.GetKlineRange(ctx, []string{"AGGUSDT"}, "5m", base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("range read failed: %v", err)
+	}
+	if len(got) != 1 || !got[0].Start.Equal(base) {
+		t.Fatalf("unexpected aggregate result: %+v", got)
+	}
+	if got[0].Volume.String() != "50" || got[0].Close.String() != "1.1" {
+		t.Errorf("unexpected aggregate values: volume=%s close=%s", got[0].Volume, got[0].Close)
+	}
+}
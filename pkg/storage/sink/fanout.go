@@ -0,0 +1,133 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"wscollector/internal/bybit/memorystore"
+)
+
+// unhealthyAfter is how many consecutive write errors mark a sink unhealthy.
+const unhealthyAfter = 3
+
+// Health describes one sink behind a FanOut.
+type Health struct {
+	Name              string
+	Healthy           bool
+	Writes            int64
+	Errors            int64
+	ConsecutiveErrors int64
+	LastError         error
+	LastErrorAt       time.Time
+	LastSuccessAt     time.Time
+}
+
+// FanOut writes every kline to several sinks. A failing or panicking sink does not
+// prevent the others from receiving the kline; its errors are tracked per sink.
+type FanOut struct {
+	sinks []KlineSink
+
+	mu     sync.Mutex
+	health []Health
+}
+
+// NewFanOut creates a fan-out over the given sinks, written in order.
+func NewFanOut(sinks ...KlineSink) *FanOut {
+	f := &FanOut{sinks: sinks, health: make([]Health, len(sinks))}
+	for i, s := range sinks {
+		f.health[i] = Health{Name: s.Name(), Healthy: true}
+	}
+	return f
+}
+
+func (f *FanOut) Name() string { return "fanout" }
+
+// WriteKline writes k to every sink and returns the joined errors of the sinks that failed.
+func (f *FanOut) WriteKline(k memorystore.KlineMemory) error {
+	var errs []error
+	for i, s := range f.sinks {
+		err := safeWrite(s, k)
+		f.record(i, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink, even if some fail, and returns their joined errors.
+func (f *FanOut) Close() error {
+	var errs []error
+	for _, s := range f.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Health returns an error naming the unhealthy sinks, or nil if all are healthy.
+func (f *FanOut) Health() error {
+	var errs []error
+	for _, h := range f.Status() {
+		if !h.Healthy {
+			errs = append(errs, fmt.Errorf("%s: %w", h.Name, h.LastError))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Status reports the health of every sink. Sinks that implement HealthChecker are
+// also unhealthy while their own check fails.
+func (f *FanOut) Status() []Health {
+	f.mu.Lock()
+	out := append([]Health(nil), f.health...)
+	f.mu.Unlock()
+
+	for i, s := range f.sinks {
+		checker, ok := s.(HealthChecker)
+		if !ok {
+			continue
+		}
+		if err := checker.Health(); err != nil {
+			out[i].Healthy = false
+			out[i].LastError = err
+		}
+	}
+	return out
+}
+
+func (f *FanOut) record(i int, err error) {
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h := &f.health[i]
+	h.Writes++
+	if err == nil {
+		h.ConsecutiveErrors = 0
+		h.LastSuccessAt = now
+		h.Healthy = true
+		return
+	}
+	h.Errors++
+	h.ConsecutiveErrors++
+	h.LastError = err
+	h.LastErrorAt = now
+	if h.ConsecutiveErrors >= unhealthyAfter {
+		h.Healthy = false
+	}
+}
+
+// safeWrite turns a panic in a sink into an error so other sinks still run.
+func safeWrite(s KlineSink, k memorystore.KlineMemory) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.WriteKline(k)
+}
@@ -0,0 +1,120 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+
+	"wscollector/internal/bybit/memorystore"
+)
+
+type fakeSink struct {
+	name   string
+	err    error
+	panics bool
+	health error
+	writes int
+	closed bool
+}
+
+func (s *fakeSink) Name() string { return s.name }
+
+func (s *fakeSink) WriteKline(memorystore.KlineMemory) error {
+	if s.panics {
+		panic("boom")
+	}
+	s.writes++
+	return s.err
+}
+
+func (s *fakeSink) Close() error {
+	s.closed = true
+	return s.err
+}
+
+type checkedSink struct {
+	fakeSink
+}
+
+func (s *checkedSink) Health() error { return s.health }
+
+func TestFanOut(t *testing.T) {
+	k := memorystore.KlineMemory{Symbol: "BTCUSDT", Kline: memorystore.Kline{Interval: "1m", Start: 0, End: 59999}}
+
+	t.Run("isolates failing sinks", func(t *testing.T) {
+		failing := &fakeSink{name: "failing", err: errors.New("down")}
+		panicking := &fakeSink{name: "panicking", panics: true}
+		good := &fakeSink{name: "good"}
+		f := NewFanOut(failing, panicking, good)
+
+		err := f.WriteKline(k)
+		if err == nil {
+			t.Fatal("expected joined error")
+		}
+		if !errors.Is(err, failing.err) {
+			t.Errorf("error %v does not wrap the failing sink's error", err)
+		}
+		if good.writes != 1 {
+			t.Errorf("good sink got %d writes, want 1", good.writes)
+		}
+	})
+
+	t.Run("marks unhealthy after consecutive errors", func(t *testing.T) {
+		flaky := &fakeSink{name: "flaky", err: errors.New("down")}
+		f := NewFanOut(flaky, &fakeSink{name: "good"})
+
+		for i := 1; i <= unhealthyAfter; i++ {
+			_ = f.WriteKline(k)
+			healthy := f.Status()[0].Healthy
+			if want := i < unhealthyAfter; healthy != want {
+				t.Fatalf("after %d errors healthy = %v, want %v", i, healthy, want)
+			}
+		}
+		if f.Health() == nil {
+			t.Fatal("Health() = nil with an unhealthy sink")
+		}
+		status := f.Status()
+		if status[0].Errors != unhealthyAfter || !status[1].Healthy {
+			t.Errorf("unexpected status %+v", status)
+		}
+
+		flaky.err = nil
+		_ = f.WriteKline(k)
+		if h := f.Status()[0]; !h.Healthy || h.ConsecutiveErrors != 0 {
+			t.Errorf("sink did not recover: %+v", h)
+		}
+	})
+
+	t.Run("uses health checkers", func(t *testing.T) {
+		checked := &checkedSink{fakeSink{name: "checked", health: errors.New("batch failed")}}
+		f := NewFanOut(checked)
+		if err := f.WriteKline(k); err != nil {
+			t.Fatalf("WriteKline: %v", err)
+		}
+		if f.Health() == nil {
+			t.Error("Health() = nil while the checker reports an error")
+		}
+	})
+
+	t.Run("closes every sink", func(t *testing.T) {
+		a := &fakeSink{name: "a", err: errors.New("close failed")}
+		b := &fakeSink{name: "b"}
+		if err := NewFanOut(a, b).Close(); err == nil {
+			t.Error("expected close error")
+		}
+		if !a.closed || !b.closed {
+			t.Error("not every sink was closed")
+		}
+	})
+}
+
+func TestMemorySinkIgnoresOtherPriceTypes(t *testing.T) {
+	store := memorystore.NewKlineStore(memorystore.KlineRetention{})
+	s := Memory(store)
+
+	_ = s.WriteKline(memorystore.KlineMemory{Symbol: "BTCUSDT", Kline: memorystore.Kline{Interval: "1m", PriceType: "mark", Start: 0, End: 59999}})
+	_ = s.WriteKline(memorystore.KlineMemory{Symbol: "BTCUSDT", Kline: memorystore.Kline{Interval: "1m", PriceType: "last", Start: 60000, End: 119999}})
+
+	if n := store.CountAll(); n != 1 {
+		t.Errorf("store holds %d klines, want 1", n)
+	}
+}
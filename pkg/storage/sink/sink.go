@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"wscollector/internal/bybit/memorystore"
+	"wscollector/pkg/storage/postgres"
+)
+
+// KlineSink receives confirmed klines for storage.
+type KlineSink interface {
+	// Name identifies the sink in logs and health reports.
+	Name() string
+	// WriteKline stores or queues one confirmed kline.
+	WriteKline(k memorystore.KlineMemory) error
+	// Close flushes anything buffered and releases the sink.
+	Close() error
+}
+
+// HealthChecker is implemented by sinks that fail asynchronously (e.g., batching writers),
+// so their health is not visible from WriteKline errors alone.
+type HealthChecker interface {
+	// Health returns nil while the sink is working, or its most recent error.
+	Health() error
+}
+
+// memorySink adds last-traded klines to a MemoryKlineStore.
+type memorySink struct {
+	store *memorystore.MemoryKlineStore
+}
+
+// Memory returns a sink backed by the in-memory kline store. The store holds last-traded
+// candles only, so klines of other price types (mark, index, ...) are ignored.
+// Close does not close the store; its subscribers are shut down separately.
+func Memory(store *memorystore.MemoryKlineStore) KlineSink {
+	return &memorySink{store: store}
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) WriteKline(k memorystore.KlineMemory) error {
+	if k.PriceType != "" && k.PriceType != "last" {
+		return nil
+	}
+	s.store.Add(k)
+	return nil
+}
+
+func (s *memorySink) Close() error { return nil }
+
+// postgresSink queues klines on a batching KlineWriter.
+type postgresSink struct {
+	writer *postgres.KlineWriter
+}
+
+// Postgres returns a sink that writes through a KlineWriter. Close flushes the writer.
+func Postgres(writer *postgres.KlineWriter) KlineSink {
+	return &postgresSink{writer: writer}
+}
+
+func (s *postgresSink) Name() string { return "postgres" }
+
+func (s *postgresSink) WriteKline(k memorystore.KlineMemory) error {
+	record, err := postgres.ToKlineRecord(k.Symbol, k.Kline)
+	if err != nil {
+		return err
+	}
+	return s.writer.Write(record)
+}
+
+func (s *postgresSink) Close() error {
+	s.writer.Close()
+	return nil
+}
+
+func (s *postgresSink) Health() error {
+	return s.writer.LastError()
+}
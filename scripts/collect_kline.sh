@@ -15,6 +15,7 @@ REPEAT_HOURS=-1
 
 PORT=5432
 DBNAME="wscollector"
+# 컬럼 정의: pkg/storage/postgres/migrations (스키마 변경 시 아래 INSERT도 함께 수정)
 TABLENAME="kline_record"
 # require, disable
 SSLMODE="disable"
@@ -322,10 +323,10 @@ task_kline_api() {
                     now_ms=$(now_ms)
                     timestamp_time=$(format_unix_ms_precise "$now_ms")
 
-                    SQL="INSERT INTO ${TABLENAME} (symbol, interval, start, confirm, \"end\", open, close, high, low, volume, turnover, timestamp, recorded_at)
+                    SQL="INSERT INTO ${TABLENAME} (symbol, interval, price_type, start, confirm, \"end\", open, close, high, low, volume, turnover, timestamp, recorded_at)
                 VALUES
-                ('$SYMBOL', '${INTERVAL}m', '$start_time', true, '$end_time', $open, $close, $high, $low, $volume, $turnover, '$timestamp_time', '$timestamp_time')
-                ON CONFLICT (symbol, interval, start, confirm) DO NOTHING
+                ('$SYMBOL', '${INTERVAL}m', 'last', '$start_time', true, '$end_time', $open, $close, $high, $low, $volume, $turnover, '$timestamp_time', '$timestamp_time')
+                ON CONFLICT (symbol, interval, price_type, start) DO NOTHING
                 RETURNING symbol;"
 
                     EXEC_RESULT=$(execute_sql "$SQL" true)